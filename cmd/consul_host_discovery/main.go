@@ -16,6 +16,11 @@ TODO:
 */
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/valeyard77/consul_host_discover/internal/app"
 	"github.com/valeyard77/consul_host_discover/internal/config"
 )
@@ -26,5 +31,9 @@ func main() {
 		return
 	}
 
-	app.Run(cfg)
+	// stop new probes on SIGINT/SIGTERM, partial results are still written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app.Run(ctx, cfg)
 }
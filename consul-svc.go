@@ -3,7 +3,9 @@ package main
 import (
 	consulapi "github.com/hashicorp/consul/api"
 	logger "github.com/sirupsen/logrus"
-	"reflect"
+	"github.com/valeyard77/consul_host_discover/internal/netutils"
+	"errors"
+	"net/http"
 	"strconv"
 	"strings"
 )
@@ -67,6 +69,12 @@ func setSvc(consulClient *consulapi.Client, dns_name, ip, consulURL string, port
 	switch mode {
 		case "tcp":	svcCheck.TCP = ip + ":" + strconv.Itoa(port)
 		case "http": svcCheck.HTTP = "http://"+ip+ ":" + strconv.Itoa(port)
+		case "udp": svcCheck.UDP = ip + ":" + strconv.Itoa(port)
+		case "https":
+			svcCheck.HTTP = "https://"+ip+ ":" + strconv.Itoa(port)
+			//check goes to ip, certificate is issued for the name
+			svcCheck.TLSServerName = dns_name
+			svcCheck.TLSSkipVerify = true
 	}
 	svcCheck.Interval = "5m"
 	svcCheck.Timeout = "10s"
@@ -92,34 +100,91 @@ func setSvc(consulClient *consulapi.Client, dns_name, ip, consulURL string, port
 	}
 }
 
-func setExportsSvc(consulClient *consulapi.Client, dns_name, ip, consulURL string, port int, mode string) {
+//setExportsSvc registers exporter, its outdated mode_dns service is removed once if registered lists it
+func setExportsSvc(consulClient *consulapi.Client, dns_name, ip, consulURL string, exp exporter, registered map[string]bool) {
+	mode, port := exp.Name, exp.Port
 	svcCheck:= new(consulapi.AgentServiceCheck)
 	svcCheck.CheckID = mode + "_check_" + dns_name + "_" + strconv.Itoa(port)
 	svcCheck.Name = mode + " test: " + dns_name + "[" + strconv.Itoa(port) + "]"
-	svcCheck.HTTP = "http://"+ip + ":" + strconv.Itoa(port)
+	//check the root page, metrics endpoint may require auth (rabbitmq /api/metrics)
+	svcCheck.HTTP = exp.Scheme + "://" + ip + ":" + strconv.Itoa(port)
+	if exp.Scheme == "https" {
+		svcCheck.TLSServerName = dns_name
+		svcCheck.TLSSkipVerify = true
+	}
 	svcCheck.Interval = "5m"
 	svcCheck.Timeout = "10s"
 	svcCheck.FailuresBeforeCritical = FailuresBeforeCritical
 	svcCheck.DeregisterCriticalServiceAfter = DeregisterServiceTime
 	service.Check = svcCheck
 
-	service.ID = mode+"_"+dns_name
+	//same exporter may run on several ports
+	service.ID = mode+"_"+dns_name+"_"+strconv.Itoa(port)
 	service.Name = "prometheus_"+mode
 	service.Address = dns_name
 	service.Port = port
 	service.Tags = []string  {mode, "prometheus-" + mode }
+	service.Meta["metrics_path"] = exp.Path
+	service.Meta["scheme"] = exp.Scheme
+	if exp.Version != "" {
+		service.Meta["version"] = exp.Version
+	}
 
 	err := consulClient.Agent().ServiceRegister(&service)
+	delete(service.Meta, "metrics_path")
+	delete(service.Meta, "scheme")
+	delete(service.Meta, "version")
 	if err != nil {
 		logger.WithFields(logger.Fields{
 			"function": "consul-svc.go/setExportsSvc/ServiceRegister()",
 			"consulURL": consulURL,
 			"svcName": "consul_" + mode,
-			"svcID": mode+"_"+dns_name,
+			"svcID": service.ID,
 		}).Errorln(err)
 	} else {
 		logger.Infof("ServiceID %s on %s (port: %d) - registration: OK", mode, dns_name, port)
+		//exporters were registered as mode_dns before, one per host
+		legacyID := mode+"_"+dns_name
+		if registered[legacyID] {
+			deregisterSvc(consulClient, legacyID, consulURL)
+			delete(registered, legacyID)
+		}
+	}
+}
+
+//registeredServices returns IDs of services registered on agent, nil if they can not be listed
+func registeredServices(consulClient *consulapi.Client, consulURL string) map[string]bool {
+	svcs, err := consulClient.Agent().Services()
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"function": "consul-svc.go/registeredServices/Services()",
+			"consulURL": consulURL,
+		}).Errorln(err)
+		return nil
+	}
+	ids := make(map[string]bool, len(svcs))
+	for id := range svcs {
+		ids[id] = true
 	}
+	return ids
+}
+
+//deregisterSvc removes service registered under outdated ID, unknown ID is not an error
+func deregisterSvc(consulClient *consulapi.Client, svcID, consulURL string) {
+	err := consulClient.Agent().ServiceDeregister(svcID)
+	if err == nil {
+		logger.Infof("ServiceID %s - deregistration: OK", svcID)
+		return
+	}
+	var statusErr consulapi.StatusError
+	if errors.As(err, &statusErr) && (statusErr.Code == http.StatusNotFound || strings.Contains(statusErr.Body, "Unknown service")) {
+		return
+	}
+	logger.WithFields(logger.Fields{
+		"function": "consul-svc.go/deregisterSvc/ServiceDeregister()",
+		"consulURL": consulURL,
+		"svcID": svcID,
+	}).Errorln(err)
 }
 
 func setConsulSVC(consulURL, token, datacenter string, listHostServices *[]consulHostSvc) {
@@ -132,6 +197,7 @@ func setConsulSVC(consulURL, token, datacenter string, listHostServices *[]consu
 			"consulDC": datacenter,
 		}).Fatalln(err)
 	}
+	registered := registeredServices(consulClient, consulURL)
 
 	for _, data:= range *listHostServices {
 		dns_name := data.Svc.HOSTNAME
@@ -144,19 +210,11 @@ func setConsulSVC(consulURL, token, datacenter string, listHostServices *[]consu
 		if strings.Index(ip, "192.168.0") != -1 { location = "nekrasovka" }
 		if strings.Index(ip, "192.168.3") != -1 { location = "noginsk" }
 
-		if strings.Index(dns_name,"light") != -1 { group = "light" }
-		if strings.Index(dns_name, "ipcam") != -1 { group = "ipcam" }
-		if strings.Index(dns_name, "hs") != -1 { group = "sockets" }
-		if strings.Index(dns_name,"mpwr") != -1 { group = "sockets" }
-		if strings.Index(dns_name,"uc") != -1 { group = "unicontroller" }
-		if strings.Index(dns_name, "vacuum") != -1 { group = "vacuum" }
-		if strings.Index(dns_name, "gw") != -1 { group = "netdevice" }
-		if strings.Index(dns_name, "mikrotik") != -1 { group = "netdevice" }
-		if strings.Index(dns_name, "ha") != -1 { group = "home-assistant" }
-		if strings.Index(dns_name, "qnap") != -1 { group = "qnap" }
-		if strings.Index(dns_name, "mqtt") != -1 { group = "mqtt-server" }
-		if strings.Index(dns_name, "printer") != -1 { group = "printer" }
-		if strings.Index(dns_name, "openhab") != -1 { group = "openhab" }
+		if g := netutils.DetectGroup(dns_name); g != "" { group = g }
+
+		//static inventory attributes take precedence
+		if data.Svc.GROUP != "" { group = data.Svc.GROUP }
+		if data.Svc.LOCATION != "" { location = data.Svc.LOCATION }
 
 		mode = "icmp"
 		svcName = mode+"-check"
@@ -166,6 +224,20 @@ func setConsulSVC(consulURL, token, datacenter string, listHostServices *[]consu
 			"location": location,
 			"group":    group,
 			"ip": ip,
+			"zone": data.Svc.ZONE,
+			"liveness": data.Svc.LIVENESS,
+		}
+		if data.Svc.MAC != "" {
+			service.Meta["mac"] = data.Svc.MAC
+		}
+		for k, v := range data.Svc.PING.Meta {
+			service.Meta[k] = v
+		}
+		//inventory meta never overrides discovery attributes
+		for k, v := range data.Svc.META {
+			if _, ok := service.Meta[k]; !ok {
+				service.Meta[k] = v
+			}
 		}
 
 		//Set ICMP checking
@@ -177,8 +249,29 @@ func setConsulSVC(consulURL, token, datacenter string, listHostServices *[]consu
 			svcName = mode+"-check"
 			service.Meta["job"] =  "consul_blackbox_tcp_autodiscovery"
 			service.Meta["service"] =  svcName
+			//service identified by banner or known by port number
+			if name, ok := data.Svc.TCPCheck.Services[tcpport]; ok {
+				service.Meta["service_name"] = name
+			}
+			if banner, ok := data.Svc.TCPCheck.Banners[tcpport]; ok {
+				service.Meta["banner"] = banner
+			}
+			setCertMeta(data.Svc.TLS[tcpport])
 
 			setSvc(consulClient, dns_name, ip, consulURL, tcpport, mode)
+			delete(service.Meta, "service_name")
+			delete(service.Meta, "banner")
+			setCertMeta(nil)
+		}
+
+		//Set UDP checking for ports answered to protocol probe
+		for _, udpport:= range data.Svc.UDPCheck.Ports {
+			mode = "udp"
+			svcName = mode+"-check"
+			service.Meta["job"] =  "consul_blackbox_udp_autodiscovery"
+			service.Meta["service"] =  svcName
+
+			setSvc(consulClient, dns_name, ip, consulURL, udpport, mode)
 		}
 
 		//set svc for http ports
@@ -187,31 +280,82 @@ func setConsulSVC(consulURL, token, datacenter string, listHostServices *[]consu
 			svcName = mode+"-check"
 			service.Meta["job"] =  "consul_blackbox_http_autodiscovery"
 			service.Meta["service"] =  svcName
+			setFingerprintMeta(data.Svc.FINGERPRINTS, httpport)
+			setHTTPMeta(data.Svc.HTTPINFO[httpport])
 
 			setSvc(consulClient, dns_name, ip, consulURL, httpport, mode)
+			setFingerprintMeta(nil, httpport)
+			setHTTPMeta(nil)
+		}
+
+		//set svc for https ports, certificate attributes go to meta
+		for _, httpsport:= range data.Svc.HTTPS.Ports {
+			mode = "https"
+			svcName = mode+"-check"
+			service.Meta["job"] =  "consul_blackbox_https_autodiscovery"
+			service.Meta["service"] =  svcName
+			setCertMeta(data.Svc.TLS[httpsport])
+			setFingerprintMeta(data.Svc.FINGERPRINTS, httpsport)
+			setHTTPMeta(data.Svc.HTTPINFO[httpsport])
+
+			setSvc(consulClient, dns_name, ip, consulURL, httpsport, mode)
+			setCertMeta(nil)
+			setFingerprintMeta(nil, httpsport)
+			setHTTPMeta(nil)
 		}
 
 		//set svc for found exporters
-		expStruct := data.Svc.Exporters[0]
-		e:= reflect.ValueOf(&expStruct).Elem()
-		for i:=0; i < e.NumField(); i ++ {
-			exporter := e.Type().Field(i).Name
-			ePort := e.Field(i).Interface()
-			if ePort.(int) != 0 {
-				t := strings.ToLower(exporter)
-				dind := strings.Index(t, "exporter")
-				if dind != -1 {
-					mode = t[:dind] + "_" + t[dind:]
-				} else {
-					mode = t
-				}
-				service.Meta["job"] =  "consul_+" + mode + "+_autodiscovery"
-				service.Meta["service"] =  svcName
-				setExportsSvc(consulClient, dns_name, ip, consulURL, ePort.(int), mode)
-			}
+		for _, exp := range data.Svc.Exporters {
+			mode = exp.Name
+			service.Meta["job"] =  "consul_+" + mode + "+_autodiscovery"
+			service.Meta["service"] =  svcName
+			setExportsSvc(consulClient, dns_name, ip, consulURL, exp, registered)
 		}
+	}
+}
 
+//setCertMeta puts certificate attributes to service meta, nil removes them
+func setCertMeta(cert *netutils.Certificate) {
+	for k := range (&netutils.Certificate{}).Meta() {
+		delete(service.Meta, k)
+	}
+	if cert == nil {
+		return
+	}
+	for k, v := range cert.Meta() {
+		service.Meta[k] = v
 	}
 }
 
+//setHTTPMeta puts response attributes of web page to service meta, nil removes them
+func setHTTPMeta(info *netutils.HTTPInfo) {
+	for k := range (&netutils.HTTPInfo{}).Meta() {
+		delete(service.Meta, k)
+	}
+	if info == nil {
+		return
+	}
+	for k, v := range info.Meta() {
+		if v != "" {
+			service.Meta[k] = v
+		}
+	}
+}
 
+//setFingerprintMeta puts service recognized on port to service meta, removes it if there is none
+func setFingerprintMeta(fingerprints map[int]fingerprint, port int) {
+	delete(service.Meta, "service_name")
+	delete(service.Meta, "service_version")
+	delete(service.Meta, "tags")
+	f, ok := fingerprints[port]
+	if !ok {
+		return
+	}
+	service.Meta["service_name"] = f.Service
+	if f.Version != "" {
+		service.Meta["service_version"] = f.Version
+	}
+	if len(f.Tags) > 0 {
+		service.Meta["tags"] = strings.Join(f.Tags, ",")
+	}
+}
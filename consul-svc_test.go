@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testAgent is consul agent API keeping registered service IDs
+type testAgent struct {
+	mu           sync.Mutex
+	services     map[string]bool
+	deregistered []string
+	// listing of services fails if set
+	unavailable bool
+}
+
+func (a *testAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/agent/services":
+		if a.unavailable {
+			http.Error(w, "rpc error", http.StatusInternalServerError)
+			return
+		}
+		svcs := make(map[string]map[string]string)
+		for id := range a.services {
+			svcs[id] = map[string]string{"ID": id}
+		}
+		_ = json.NewEncoder(w).Encode(svcs)
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/agent/service/register":
+		var reg struct{ ID string }
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.services[reg.ID] = true
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		a.deregistered = append(a.deregistered, id)
+		if !a.services[id] {
+			http.Error(w, "Unknown service ID "+id, http.StatusNotFound)
+			return
+		}
+		delete(a.services, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSetExportsSvc(t *testing.T) {
+	agent := &testAgent{services: map[string]bool{"node_exporter_nas.hm.net": true, "icmp_nas.hm.net": true}}
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+	client, err := initConsul(srv.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Meta = map[string]string{}
+
+	registered := registeredServices(client, srv.URL)
+	if len(registered) != 2 || !registered["node_exporter_nas.hm.net"] {
+		t.Fatalf("registered = %v", registered)
+	}
+	exp := exporter{Name: "node_exporter", Port: 9100, Path: "/metrics", Scheme: "http"}
+	// scans repeat registration of the same exporters
+	for range 2 {
+		setExportsSvc(client, "nas.hm.net", "192.168.2.10", srv.URL, exp, registered)
+		setExportsSvc(client, "cam.hm.net", "192.168.2.20", srv.URL, exp, registered)
+	}
+
+	// legacy service is removed once, exporters without one are not deregistered
+	if !slices.Equal(agent.deregistered, []string{"node_exporter_nas.hm.net"}) {
+		t.Errorf("deregistered = %v", agent.deregistered)
+	}
+	for _, id := range []string{"node_exporter_nas.hm.net_9100", "node_exporter_cam.hm.net_9100", "icmp_nas.hm.net"} {
+		if !agent.services[id] {
+			t.Errorf("service %s is not registered, agent has %v", id, agent.services)
+		}
+	}
+	if agent.services["node_exporter_nas.hm.net"] || len(service.Meta) != 0 {
+		t.Errorf("agent has %v, meta = %v", agent.services, service.Meta)
+	}
+
+	// agent services can not be listed, nothing is deregistered
+	agent.deregistered = nil
+	agent.services["node_exporter_nas.hm.net"] = true
+	agent.unavailable = true
+	if registered = registeredServices(client, srv.URL); registered != nil {
+		t.Errorf("registered = %v of failed listing", registered)
+	}
+	setExportsSvc(client, "nas.hm.net", "192.168.2.10", srv.URL, exp, nil)
+	if len(agent.deregistered) != 0 {
+		t.Errorf("deregistered = %v without listing", agent.deregistered)
+	}
+}
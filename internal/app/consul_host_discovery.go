@@ -1,18 +1,213 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/valeyard77/consul_host_discover/internal/config"
 	"github.com/valeyard77/consul_host_discover/internal/netutils"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func Run(cfg *config.Config) {
-	iplist, err := netutils.ExpandCIDR(cfg.Subnet)
+// Run discovers hosts until done or until ctx is cancelled or scan timeout is over,
+// in both cases hosts found so far are written out
+func Run(ctx context.Context, cfg *config.Config) {
+	if cfg.ScanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ScanTimeout)
+		defer cancel()
+	}
+	netutils.SetRateLimiter(cfg.RateLimiter)
+
+	// service names are needed by port specs of scan profiles
+	if err := netutils.LoadServices(cfg.Services); err != nil {
+		cfg.Logger.Fatalln(err)
+	}
+	if cfg.Fingerprints != "" {
+		if err := netutils.LoadFingerprints(cfg.Fingerprints); err != nil {
+			cfg.Logger.Fatalln(err)
+		}
+	}
+	profiles, err := cfg.ScanProfiles()
+	if err != nil {
+		cfg.Logger.Fatalln(err)
+	}
+
+	monitoringHosts := make(netutils.Inventory)
+	if cfg.Inventory != "" {
+		static, err := netutils.LoadInventoryFile(cfg.Inventory)
+		if err != nil {
+			cfg.Logger.Fatalln(err)
+		}
+		monitoringHosts.Merge(static)
+	}
+	for _, source := range cfg.DHCPLeases {
+		leases, err := netutils.LoadDHCPLeases(ctx, source, cfg.DHCPFormat)
+		if err != nil {
+			cfg.Logger.Errorln(err)
+			continue
+		}
+		monitoringHosts.Merge(leases)
+	}
+	if cfg.MDNS {
+		services, err := netutils.BrowseMDNS(ctx, netutils.MDNSServiceTypes, cfg.MDNSTimeout)
+		if err != nil {
+			cfg.Logger.Errorln(err)
+		}
+		monitoringHosts.Merge(netutils.MDNSHosts(services))
+	}
+
+	// hosts known by name get their group limits before the first ping
+	assignGroups(cfg, monitoringHosts)
+
+	targets, err := netutils.ParseTargets(cfg.Subnet, cfg.Exclude)
 	if err != nil {
 		cfg.Logger.Fatalln(err)
 	}
 
-	monitoringHosts := netutils.PingAlive(iplist, cfg.Threads)
-	fmt.Println(monitoringHosts)
+	aliveHosts := make(netutils.Inventory)
+	for _, res := range pingTargets(ctx, cfg, targets) {
+		aliveHosts.Add(netutils.Host{IP: res.IP, Source: netutils.SourceScan, Liveness: res.Method, Ping: &res})
+	}
+	if cfg.ARP {
+		for ip, mac := range netutils.ARPAlive(ctx, targets, cfg.ARPProbe) {
+			aliveHosts.Add(netutils.Host{IP: ip, Source: netutils.SourceScan, MAC: mac, Liveness: netutils.LivenessARP})
+		}
+	}
+
+	// resolve names only for hosts unknown to static inventory and dhcp leases
+	var unknownHosts []netutils.Host
+	for _, host := range aliveHosts.Hosts() {
+		if known, ok := monitoringHosts[host.IP]; ok && known.Hostname != "" {
+			monitoringHosts.Add(host)
+			continue
+		}
+		unknownHosts = append(unknownHosts, host)
+	}
+	resolver := netutils.NewResolver(cfg.Resolver)
+	monitoringHosts.Merge(resolver.Enrich(ctx, unknownHosts, cfg.Threads))
+	// names of scanned hosts are known now, their groups select scan profile and limits of port probes
+	assignGroups(cfg, monitoringHosts)
+
+	scanPorts(ctx, cfg, profiles, monitoringHosts, aliveHosts)
+
+	if err = ctx.Err(); err != nil {
+		cfg.Logger.Warnf("Scan interrupted (%v), writing partial results", err)
+	}
+	writeHosts(monitoringHosts)
+}
+
+// assignGroups derives group of a host without static one from its name and
+// registers it in rate limiter, so group limits and scan profiles apply to discovered hosts
+func assignGroups(cfg *config.Config, hosts netutils.Inventory) {
+	for _, host := range hosts {
+		if host.Group == "" {
+			host.Group = netutils.DetectGroup(host.Hostname)
+		}
+		if host.Group != "" {
+			cfg.RateLimiter.SetHostGroup(host.IP, host.Group)
+		}
+	}
+}
+
+// writeHosts prints inventory to stdout
+func writeHosts(monitoringHosts netutils.Inventory) {
+	for _, host := range monitoringHosts.Hosts() {
+		var rtt, loss string
+		if host.Ping != nil {
+			rtt = fmt.Sprintf("%v/%v/%v/%v", host.Ping.MinRTT, host.Ping.AvgRTT, host.Ping.MaxRTT, host.Ping.Jitter)
+			loss = fmt.Sprintf("%.1f%%", host.Ping.Loss)
+		}
+		var ports []string
+		for _, p := range host.Ports {
+			port := fmt.Sprintf("%d/%s", p.Port, p.Proto)
+			if p.Service != "" && p.Version != "" {
+				port += "(" + p.Service + " " + p.Version + ")"
+			} else if p.Service != "" {
+				port += "(" + p.Service + ")"
+			}
+			if p.TLS != nil {
+				port += "(tls)"
+			}
+			if p.HTTP != nil {
+				port += "[" + strconv.Itoa(p.HTTP.Status) + "]"
+			}
+			ports = append(ports, port)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n", host.Hostname, host.IP, host.MAC, host.Liveness, rtt, loss,
+			strings.Join(ports, ","))
+	}
+}
+
+// pingTargets sweeps targets from a single socket if configured,
+// falling back to pinger per host when ICMP socket can not be opened
+func pingTargets(ctx context.Context, cfg *config.Config, targets *netutils.TargetSet) []netutils.PingResult {
+	if cfg.PingSweep {
+		results, err := netutils.NewSweeper(cfg.Ping, cfg.PingPPS).Sweep(ctx, targets.All())
+		if err == nil {
+			return results
+		}
+		cfg.Logger.Warnf("ICMP sweep failed, fallback to pinger per host: %v", err)
+	}
+	return netutils.PingAlive(ctx, targets.All(), cfg.Threads, cfg.Ping)
+}
+
+// scanPorts probes ports of alive hosts by scan profile of their group
+// and stores open ones in inventory
+func scanPorts(ctx context.Context, cfg *config.Config, profiles *netutils.ScanProfiles, monitoringHosts, aliveHosts netutils.Inventory) {
+	var probes []netutils.PortProbe
+	for _, alive := range aliveHosts.Hosts() {
+		host := monitoringHosts[alive.IP]
+		probes = append(probes, profiles.Probes(host.Hostname, *host)...)
+	}
+	results := netutils.ScanPorts(ctx, probes, cfg.Threads)
+	for _, res := range results {
+		if res.Open {
+			host := monitoringHosts[res.IP]
+			host.Ports = append(host.Ports, res)
+		}
+	}
+	writeCertificates(cfg, netutils.TLSEndpoints(results))
+}
+
+// writeCertificates writes certificate expiry report and ssl_exporter targets if configured
+func writeCertificates(cfg *config.Config, endpoints []netutils.TLSEndpoint) {
+	if cfg.TLSReport != "" {
+		if err := writeFile(cfg.TLSReport, func(w io.Writer) error {
+			return netutils.WriteCertReport(w, endpoints, cfg.TLSWarn)
+		}); err != nil {
+			cfg.Logger.Errorln(err)
+		}
+	}
+	if cfg.SSLExporterTargets != "" {
+		if err := writeFile(cfg.SSLExporterTargets, func(w io.Writer) error {
+			return netutils.WriteSSLExporterTargets(w, endpoints)
+		}); err != nil {
+			cfg.Logger.Errorln(err)
+		}
+	}
+	for _, e := range endpoints {
+		if e.Cert.NotAfter.Before(time.Now().Add(cfg.TLSWarn)) {
+			cfg.Logger.Warnf("Certificate of %s (%s) expires %v", e.Target(), e.Cert.Subject, e.Cert.NotAfter)
+		}
+	}
+}
 
+// writeFile writes to path, "-" means stdout
+func writeFile(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write %s, %w", path, err)
+	}
+	return f.Close()
 }
@@ -1,14 +1,73 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 )
 
 var (
 	//app
-	subnet  = pflag.StringP("subnet", "n", "192.168.2.0/24", "Subnet for search, ex: 192.168.2.0/24")
+	subnet  = pflag.StringSliceP("subnet", "n", []string{"192.168.2.0/24"}, "Subnets, ranges or hosts for search, ex: 192.168.2.0/24,192.168.1.10-192.168.1.50,192.168.3.1")
+	exclude = pflag.StringSlice("exclude", nil, "Subnets, ranges or hosts excluded from search, ex: 192.168.2.1,192.168.2.200-192.168.2.254")
 	threads = pflag.Int("threads", 14, "Number of threads, default=14")
 
+	scanTimeout = pflag.Duration("scan-timeout", 0, "Overall scan time budget, ex: 5m, unlimited if 0")
+
+	//dhcp
+	dhcpLeases = pflag.StringSlice("dhcp.leases", nil, "DHCP lease files or http(s) urls, merged with scan results")
+	dhcpFormat = pflag.String("dhcp.format", "", "DHCP lease file format [dnsmasq/isc], detected by content if empty")
+
+	//mdns
+	mdns        = pflag.Bool("mdns", false, "Browse mDNS/DNS-SD services on local network")
+	mdnsTimeout = pflag.Duration("mdns.timeout", 3*time.Second, "mDNS browse time")
+
+	//ping
+	pingPrivileged  = pflag.Bool("ping.privileged", false, "Use raw ICMP sockets (requires CAP_NET_RAW), unprivileged UDP ICMP otherwise")
+	pingCount       = pflag.Int("ping.count", 2, "Number of ICMP echo requests per host")
+	pingInterval    = pflag.Duration("ping.interval", 200*time.Millisecond, "Interval between ICMP echo requests")
+	pingTimeout     = pflag.Duration("ping.timeout", 1*time.Second, "ICMP ping timeout per host")
+	pingTCPFallback = pflag.Bool("ping.tcp-fallback", true, "Treat TCP SYN-ACK or RST as alive when ICMP is not permitted")
+	pingSweep       = pflag.Bool("ping.sweep", false, "Sweep all targets from a single ICMP socket instead of a pinger per host")
+	pingPPS         = pflag.Int("ping.pps", 0, "ICMP sweep packets per second budget, unlimited if 0")
+	pingTCPPorts    = pflag.IntSlice("ping.tcp-ports", []int{80, 443, 22, 445, 8080}, "Ports for TCP ping fallback")
+
+	//scan profiles
+	profile       = pflag.String("profile", "", "Scan profile [quick/iot/full/custom] or one from --profiles file, quick by default")
+	profilesFile  = pflag.String("profiles", "", "Scan profiles yaml file with profiles, default profile and group profiles")
+	profileGroups = pflag.StringSlice("profile.group", nil, "Scan profile of host group group:profile, ex: ipcam:iot")
+	portsTCP      = pflag.StringSlice("ports.tcp", nil, "TCP ports or service names of custom profile, ex: ssh,8000-8100,top20")
+	portsHTTP     = pflag.StringSlice("ports.http", nil, "HTTP ports of custom profile, ex: 80,8080-8090")
+	portsUDP      = pflag.StringSlice("ports.udp", nil, "UDP ports of custom profile [53/161/5353/5683/54321]")
+	banners       = pflag.Bool("banners", false, "Identify services on open tcp ports by greetings and hello probes")
+
+	//fingerprints
+	fingerprints = pflag.String("fingerprints", "", "HTTP fingerprint rules yaml file, checked before built-in rules")
+
+	//service names
+	servicesFile = pflag.String("services", "", "Service names file in /etc/services format, overrides built-in and system names")
+
+	//tls
+	tlsDetect          = pflag.Bool("tls", true, "Detect TLS on open ports and collect certificates, http is checked over https on TLS ports")
+	tlsReport          = pflag.String("tls.report", "", "Certificate expiry report file, - for stdout, disabled if empty")
+	tlsWarn            = pflag.Duration("tls.warn", 30*24*time.Hour, "Warn about certificates expiring within this time")
+	sslExporterTargets = pflag.String("tls.ssl-exporter-targets", "", "Prometheus file_sd targets file for ssl_exporter, - for stdout, disabled if empty")
+
+	//rate limits
+	ratePPS     = pflag.Int("rate.pps", 0, "Packets per second for all probes, unlimited if 0")
+	ratePerHost = pflag.Int("rate.per-host", 0, "Concurrent probes per host, unlimited if 0")
+	rateGroups  = pflag.StringSlice("rate.group", nil, "Per group overrides group:pps:per-host, ex: sockets:5:1")
+
+	//liveness
+	arp      = pflag.Bool("arp", false, "Treat hosts from kernel neighbour table as alive")
+	arpProbe = pflag.Bool("arp.probe", false, "Send ARP who-has requests for targets on connected networks, requires CAP_NET_RAW")
+
+	//inventory
+	inventory = pflag.StringP("inventory", "i", "", "Static inventory file [yaml/csv/hosts], merged with scan results")
+
+	//dns
+	resolver = pflag.String("resolver", "", "DNS server for PTR lookups [host:port], system resolver by default")
+
 	//logger
 	output    = pflag.StringP("log.output", "l", "stdout", "Log output mode [stdout/file]")
 	logformat = pflag.String("log.format", "text", "Log output format [text/json]")
@@ -18,11 +77,50 @@ var (
 )
 
 type Cli struct {
-	Subnet    string
-	LogOutput string
-	LogFormat string
-	Debug     bool
-	Thread    int
+	Subnet      []string
+	Exclude     []string
+	LogOutput   string
+	LogFormat   string
+	Debug       bool
+	Thread      int
+	ScanTimeout time.Duration
+	Resolver    string
+	Inventory   string
+	ARP         bool
+	ARPProbe    bool
+	DHCPLeases  []string
+	DHCPFormat  string
+	MDNS        bool
+	MDNSTimeout time.Duration
+
+	PingPrivileged  bool
+	PingCount       int
+	PingInterval    time.Duration
+	PingTimeout     time.Duration
+	PingTCPFallback bool
+	PingTCPPorts    []int
+	PingSweep       bool
+	PingPPS         int
+
+	Profile       string
+	ProfilesFile  string
+	ProfileGroups []string
+	PortsTCP      []string
+	PortsHTTP     []string
+	PortsUDP      []string
+	Banners       bool
+
+	Fingerprints string
+	Services     string
+
+	TLS                bool
+	TLSReport          string
+	TLSWarn            time.Duration
+	SSLExporterTargets string
+
+	RatePPS     int
+	RatePerHost int
+	RateGroups  []string
 }
 
 func newCli() *Cli {
@@ -33,10 +131,49 @@ func newCli() *Cli {
 	}
 
 	return &Cli{
-		Subnet:    *subnet,
-		LogOutput: *output,
-		LogFormat: *logformat,
-		Debug:     *debug,
-		Thread:    *threads,
+		Subnet:      *subnet,
+		Exclude:     *exclude,
+		LogOutput:   *output,
+		LogFormat:   *logformat,
+		Debug:       *debug,
+		Thread:      *threads,
+		ScanTimeout: *scanTimeout,
+		Resolver:    *resolver,
+		Inventory:   *inventory,
+		ARP:         *arp || *arpProbe,
+		ARPProbe:    *arpProbe,
+		DHCPLeases:  *dhcpLeases,
+		DHCPFormat:  *dhcpFormat,
+		MDNS:        *mdns,
+		MDNSTimeout: *mdnsTimeout,
+
+		PingPrivileged:  *pingPrivileged,
+		PingCount:       *pingCount,
+		PingInterval:    *pingInterval,
+		PingTimeout:     *pingTimeout,
+		PingTCPFallback: *pingTCPFallback,
+		PingTCPPorts:    *pingTCPPorts,
+		PingSweep:       *pingSweep,
+		PingPPS:         *pingPPS,
+
+		Profile:       *profile,
+		ProfilesFile:  *profilesFile,
+		ProfileGroups: *profileGroups,
+		PortsTCP:      *portsTCP,
+		PortsHTTP:     *portsHTTP,
+		PortsUDP:      *portsUDP,
+		Banners:       *banners,
+
+		Fingerprints: *fingerprints,
+		Services:     *servicesFile,
+
+		TLS:                *tlsDetect,
+		TLSReport:          *tlsReport,
+		TLSWarn:            *tlsWarn,
+		SSLExporterTargets: *sslExporterTargets,
+
+		RatePPS:     *ratePPS,
+		RatePerHost: *ratePerHost,
+		RateGroups:  *rateGroups,
 	}
 }
@@ -1,15 +1,41 @@
 package config
 
 import (
+	"time"
+
 	"github.com/sirupsen/logrus"
 
+	"github.com/valeyard77/consul_host_discover/internal/netutils"
 	"github.com/valeyard77/consul_host_discover/pkg/logging"
 )
 
 type Config struct {
-	Logger  *logrus.Logger
-	Subnet  string
-	Threads int
+	Logger      *logrus.Logger
+	Subnet      []string
+	Exclude     []string
+	Threads     int
+	ScanTimeout time.Duration
+	Resolver    string
+	Inventory   string
+	ARP         bool
+	ARPProbe    bool
+	DHCPLeases  []string
+	DHCPFormat  string
+	MDNS        bool
+	MDNSTimeout time.Duration
+	Ping        netutils.PingOptions
+	PingSweep   bool
+	PingPPS     int
+	RateLimiter *netutils.RateLimiter
+	// Services and Fingerprints files are loaded by the app before scan profiles are built
+	Services     string
+	Fingerprints string
+
+	TLSReport          string
+	TLSWarn            time.Duration
+	SSLExporterTargets string
+
+	cli *Cli
 }
 
 func New() *Config {
@@ -20,10 +46,73 @@ func New() *Config {
 
 	logger := logging.New(cli.Debug, cli.LogFormat, cli.LogOutput).InitLog()
 
+	groups, err := netutils.ParseGroupLimits(cli.RateGroups)
+	if err != nil {
+		logger.Errorln(err)
+		return nil
+	}
+
 	return &Config{
-		Logger:  logger,
-		Subnet:  cli.Subnet,
-		Threads: cli.Thread,
+		Logger:      logger,
+		Subnet:      cli.Subnet,
+		Exclude:     cli.Exclude,
+		Threads:     cli.Thread,
+		ScanTimeout: cli.ScanTimeout,
+		Resolver:    cli.Resolver,
+		Inventory:   cli.Inventory,
+		ARP:         cli.ARP,
+		ARPProbe:    cli.ARPProbe,
+		DHCPLeases:  cli.DHCPLeases,
+		DHCPFormat:  cli.DHCPFormat,
+		MDNS:        cli.MDNS,
+		MDNSTimeout: cli.MDNSTimeout,
+		Ping: netutils.PingOptions{
+			Privileged:  cli.PingPrivileged,
+			Count:       cli.PingCount,
+			Interval:    cli.PingInterval,
+			Timeout:     cli.PingTimeout,
+			TCPFallback: cli.PingTCPFallback,
+			TCPPorts:    cli.PingTCPPorts,
+		},
+		PingSweep:    cli.PingSweep,
+		PingPPS:      cli.PingPPS,
+		RateLimiter:  netutils.NewRateLimiter(cli.RatePPS, cli.RatePerHost, groups),
+		Services:     cli.Services,
+		Fingerprints: cli.Fingerprints,
+		cli:          cli,
+
+		TLSReport:          cli.TLSReport,
+		TLSWarn:            cli.TLSWarn,
+		SSLExporterTargets: cli.SSLExporterTargets,
 	}
 
 }
+
+// ScanProfiles builds scan profiles from cli options, service names of port specs must be loaded before
+func (c *Config) ScanProfiles() (*netutils.ScanProfiles, error) {
+	return newScanProfiles(c.cli)
+}
+
+// newScanProfiles returns built-in profiles extended by profiles file and cli options
+func newScanProfiles(cli *Cli) (*netutils.ScanProfiles, error) {
+	profiles := netutils.NewScanProfiles()
+	if cli.ProfilesFile != "" {
+		if err := profiles.LoadFile(cli.ProfilesFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(cli.PortsTCP) > 0 || len(cli.PortsHTTP) > 0 || len(cli.PortsUDP) > 0 {
+		if err := profiles.Set(netutils.ProfileCustom, cli.PortsTCP, cli.PortsHTTP, cli.PortsUDP); err != nil {
+			return nil, err
+		}
+	}
+	if cli.Profile != "" {
+		profiles.Default = cli.Profile
+	}
+	profiles.GrabBanners = cli.Banners
+	profiles.DetectTLS = cli.TLS
+	if err := profiles.SetGroups(cli.ProfileGroups); err != nil {
+		return nil, err
+	}
+	return profiles, profiles.Validate()
+}
@@ -0,0 +1,159 @@
+package netutils
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ethPARP       = 0x0806
+	arpReplyWait  = 1 * time.Second
+	arpMaxNetBits = 16 // do not probe interface networks larger than /16
+)
+
+// ARPProbe sends ARP who-has requests for targets on directly connected
+// IPv4 networks and returns ip => mac map of replied hosts. Requires CAP_NET_RAW
+func ARPProbe(ctx context.Context, targets *TargetSet) (map[string]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list interfaces, %w", err)
+	}
+
+	alive := make(map[string]string)
+	var errs []error
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(ipnet.String())
+			if err != nil || prefix.Bits() < arpMaxNetBits {
+				continue
+			}
+			replies, err := arpProbeInterface(ctx, iface, prefix, targets)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for ip, mac := range replies {
+				alive[ip] = mac
+			}
+		}
+	}
+	if len(alive) == 0 && len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return alive, nil
+}
+
+func arpProbeInterface(ctx context.Context, iface net.Interface, prefix netip.Prefix, targets *TargetSet) (map[string]string, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(ethPARP)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open raw socket on %s, %w", iface.Name, err)
+	}
+	defer unix.Close(fd)
+
+	if err = unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(ethPARP), Ifindex: iface.Index}); err != nil {
+		return nil, fmt.Errorf("unable to bind raw socket to %s, %w", iface.Name, err)
+	}
+	tv := unix.NsecToTimeval(int64(100 * time.Millisecond))
+	_ = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+
+	src := prefix.Addr().As4()
+	dst := &unix.SockaddrLinklayer{
+		Protocol: htons(ethPARP),
+		Ifindex:  iface.Index,
+		Halen:    6,
+		Addr:     [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+
+	var sent int
+	network := prefix.Masked()
+	for ip := network.Addr().Next(); network.Contains(ip); ip = ip.Next() {
+		if ip == prefix.Addr() || !targets.Contains(ip.String()) {
+			continue
+		}
+		if err = probeLimiter.Wait(ctx, ip.String(), 1); err != nil {
+			break
+		}
+		frame := arpRequest(iface.HardwareAddr, src, ip.As4())
+		if err = unix.Sendto(fd, frame, 0, dst); err != nil {
+			logger.WithFields(logger.Fields{
+				"function":  "arpProbeInterface",
+				"interface": iface.Name,
+				"address":   ip.String(),
+			}).Debugln(err)
+			continue
+		}
+		sent++
+	}
+	logger.WithFields(logger.Fields{
+		"function":  "arpProbeInterface",
+		"interface": iface.Name,
+		"network":   network.String(),
+	}).Debugf("Sent %d ARP requests", sent)
+
+	alive := make(map[string]string)
+	if sent == 0 {
+		return alive, nil
+	}
+	buf := make([]byte, 128)
+	deadline := time.Now().Add(arpReplyWait)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			continue
+		}
+		ip, mac, ok := parseARPReply(buf[:n])
+		if ok && targets.Contains(ip) {
+			alive[ip] = mac
+		}
+	}
+	return alive, nil
+}
+
+func arpRequest(srcMAC net.HardwareAddr, srcIP, dstIP [4]byte) []byte {
+	b := make([]byte, 42)
+	// ethernet header
+	copy(b[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(b[6:12], srcMAC)
+	binary.BigEndian.PutUint16(b[12:14], ethPARP)
+	// arp payload
+	binary.BigEndian.PutUint16(b[14:16], 1)      // ethernet
+	binary.BigEndian.PutUint16(b[16:18], 0x0800) // ipv4
+	b[18], b[19] = 6, 4
+	binary.BigEndian.PutUint16(b[20:22], 1) // who-has
+	copy(b[22:28], srcMAC)
+	copy(b[28:32], srcIP[:])
+	copy(b[38:42], dstIP[:])
+	return b
+}
+
+// parseARPReply returns sender ip and mac of an ARP reply frame
+func parseARPReply(b []byte) (string, string, bool) {
+	if len(b) < 42 || binary.BigEndian.Uint16(b[12:14]) != ethPARP || binary.BigEndian.Uint16(b[20:22]) != 2 {
+		return "", "", false
+	}
+	mac := net.HardwareAddr(b[22:28])
+	ip := netip.AddrFrom4([4]byte(b[28:32]))
+	return ip.String(), mac.String(), true
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,61 @@
+package netutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// testARPReply answers request the way host owning the target address does
+func testARPReply(req []byte, mac net.HardwareAddr) []byte {
+	b := bytes.Clone(req)
+	copy(b[0:6], req[6:12])
+	copy(b[6:12], mac)
+	binary.BigEndian.PutUint16(b[20:22], 2) // is-at
+	copy(b[32:42], req[22:32])
+	copy(b[22:28], mac)
+	copy(b[28:32], req[38:42])
+	return b
+}
+
+func TestARPRequestReply(t *testing.T) {
+	srcMAC := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	hostMAC := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x40}
+	req := arpRequest(srcMAC, [4]byte{192, 168, 2, 2}, [4]byte{192, 168, 2, 40})
+
+	want := []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x06,
+		// ethernet, ipv4, address lengths, who-has
+		0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 192, 168, 2, 2,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 192, 168, 2, 40,
+	}
+	if !bytes.Equal(req, want) {
+		t.Fatalf("arpRequest = % x, want % x", req, want)
+	}
+	// own request seen on the socket is not a reply
+	if _, _, ok := parseARPReply(req); ok {
+		t.Error("request is parsed as reply")
+	}
+
+	reply := testARPReply(req, hostMAC)
+	ip, mac, ok := parseARPReply(reply)
+	if !ok || ip != "192.168.2.40" || mac != "aa:bb:cc:dd:ee:40" {
+		t.Errorf("parseARPReply = %s, %s, %v", ip, mac, ok)
+	}
+	// ethernet frames are padded to 60 bytes
+	padded := append(bytes.Clone(reply), make([]byte, 18)...)
+	if ip, mac, ok = parseARPReply(padded); !ok || ip != "192.168.2.40" || mac != "aa:bb:cc:dd:ee:40" {
+		t.Errorf("parseARPReply of padded frame = %s, %s, %v", ip, mac, ok)
+	}
+
+	if _, _, ok = parseARPReply(reply[:41]); ok {
+		t.Error("short frame is parsed")
+	}
+	ipv4 := bytes.Clone(reply)
+	binary.BigEndian.PutUint16(ipv4[12:14], 0x0800)
+	if _, _, ok = parseARPReply(ipv4); ok {
+		t.Error("ipv4 frame is parsed")
+	}
+}
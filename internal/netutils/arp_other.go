@@ -0,0 +1,13 @@
+//go:build !linux
+
+package netutils
+
+import (
+	"context"
+	"errors"
+)
+
+// ARPProbe is supported on linux only
+func ARPProbe(ctx context.Context, targets *TargetSet) (map[string]string, error) {
+	return nil, errors.New("arp probing is not supported on this platform")
+}
@@ -0,0 +1,100 @@
+package netutils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// liveness methods
+const (
+	LivenessICMP   = "icmp"
+	LivenessTCP    = "tcp"
+	LivenessARP    = "arp"
+	LivenessStatic = "static"
+)
+
+const arpTable = "/proc/net/arp"
+
+// ReadNeighbours returns ip => mac map of complete entries from kernel neighbour table
+func ReadNeighbours() (map[string]string, error) {
+	f, err := os.Open(arpTable)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read neighbour table, %w", err)
+	}
+	defer f.Close()
+	return parseNeighbours(f)
+}
+
+// parseNeighbours parses neighbour table in /proc/net/arp format, incomplete entries are skipped
+func parseNeighbours(r io.Reader) (map[string]string, error) {
+	neighbours := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	sc.Scan() // skip header
+	for sc.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[2], 0, 32)
+		// ATF_COM, entry is resolved
+		if err != nil || flags&0x2 == 0 {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil || isZeroMAC(mac) {
+			continue
+		}
+		neighbours[fields[0]] = mac.String()
+	}
+	return neighbours, sc.Err()
+}
+
+// ARPAlive returns ip => mac map of target hosts confirmed by neighbour table.
+// If probe is set, ARP who-has requests are sent for IPv4 targets on directly
+// connected networks before reading the table
+func ARPAlive(ctx context.Context, targets *TargetSet, probe bool) map[string]string {
+	alive := make(map[string]string)
+	if probe {
+		replies, err := ARPProbe(ctx, targets)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"function": "ARPAlive",
+			}).Warnln(err)
+		}
+		for ip, mac := range replies {
+			alive[ip] = mac
+		}
+	}
+
+	neighbours, err := ReadNeighbours()
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"function": "ARPAlive",
+			"file":     arpTable,
+		}).Warnln(err)
+	}
+	for ip, mac := range neighbours {
+		if targets.Contains(ip) {
+			alive[ip] = mac
+		}
+	}
+	return alive
+}
+
+func isZeroMAC(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package netutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testARPHeader = "IP address       HW type     Flags       HW address            Mask     Device\n"
+
+func TestParseNeighbours(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		want  map[string]string
+	}{
+		{name: "complete entries", table: testARPHeader + `192.168.2.1      0x1         0x2         aa:bb:cc:dd:ee:01     *        eth0
+192.168.2.52     0x1         0x6         AA:BB:CC:DD:EE:52     *        eth0
+`, want: map[string]string{"192.168.2.1": "aa:bb:cc:dd:ee:01", "192.168.2.52": "aa:bb:cc:dd:ee:52"}},
+		// host did not answer to kernel request
+		{name: "incomplete entry", table: testARPHeader + `192.168.2.50     0x1         0x0         00:00:00:00:00:00     *        eth0
+192.168.2.1      0x1         0x2         aa:bb:cc:dd:ee:01     *        eth0
+`, want: map[string]string{"192.168.2.1": "aa:bb:cc:dd:ee:01"}},
+		{name: "incomplete entry with stale mac", table: testARPHeader + `192.168.2.51     0x1         0x0         aa:bb:cc:dd:ee:51     *        eth0
+`, want: map[string]string{}},
+		{name: "complete flag with zero mac", table: testARPHeader + `192.168.2.53     0x1         0x2         00:00:00:00:00:00     *        eth0
+10.8.0.2         0x1         0xc         00:00:00:00:00:00     *        tun0
+`, want: map[string]string{}},
+		{name: "malformed lines", table: testARPHeader + `garbage
+192.168.2.54     0x1         0xZZ        aa:bb:cc:dd:ee:54     *        eth0
+192.168.2.55     0x1         0x2         not-a-mac             *        eth0
+
+192.168.2.56     0x1         0x2         aa:bb:cc:dd:ee:56
+`, want: map[string]string{"192.168.2.56": "aa:bb:cc:dd:ee:56"}},
+		{name: "header only", table: testARPHeader, want: map[string]string{}},
+		{name: "empty", table: "", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNeighbours(strings.NewReader(tt.table))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNeighbours = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package netutils
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// bannerTimeout is how long service greeting or hello response is awaited
+const bannerTimeout = 2 * time.Second
+
+// bannerMaxLen limits banner text put to logs and consul meta
+const bannerMaxLen = 128
+
+// Banner is a service identified by its greeting or by response to hello probe
+type Banner struct {
+	Service string
+	Text    string
+}
+
+// helloProbe is a safe request for services which wait for client to speak first
+type helloProbe struct {
+	service string
+	ports   []int
+	request []byte
+	match   func(resp []byte) bool
+}
+
+var helloProbes = []helloProbe{
+	{
+		service: "redis",
+		ports:   []int{6379},
+		request: []byte("*1\r\n$4\r\nPING\r\n"),
+		match: func(resp []byte) bool {
+			for _, prefix := range []string{"+PONG", "-NOAUTH", "-ERR", "-DENIED"} {
+				if bytes.HasPrefix(resp, []byte(prefix)) {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		service: "postgresql",
+		ports:   []int{5432},
+		// SSLRequest, server answers S or N and waits for startup message
+		request: []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f},
+		match: func(resp []byte) bool {
+			return len(resp) == 1 && (resp[0] == 'S' || resp[0] == 'N')
+		},
+	},
+	{
+		service: "mqtt",
+		ports:   []int{1883, 8883},
+		request: mqttConnect("chd-probe"),
+		match: func(resp []byte) bool {
+			// CONNACK
+			return len(resp) >= 4 && resp[0] == 0x20 && resp[1] == 0x02
+		},
+	},
+}
+
+// mqttConnect is MQTT 3.1.1 CONNECT with clean session and client id
+func mqttConnect(clientID string) []byte {
+	variable := []byte{0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c}
+	payload := append([]byte{0x00, byte(len(clientID))}, clientID...)
+	b := []byte{0x10, byte(len(variable) + len(payload))}
+	b = append(b, variable...)
+	return append(b, payload...)
+}
+
+// mqttDisconnect is sent after CONNACK to close session gracefully
+var mqttDisconnect = []byte{0xe0, 0x00}
+
+// GrabBanner reads service greeting (SSH, FTP, SMTP, MySQL) and sends hello probes
+// (Redis PING, PostgreSQL SSLRequest, MQTT CONNECT) to silent services, probe for
+// the well known port goes first. Return false if service was not identified
+func GrabBanner(ctx context.Context, hostname, address string, port int) (Banner, bool) {
+	release, err := probeLimiter.Acquire(ctx, address, 1)
+	if err != nil {
+		return Banner{}, false
+	}
+	defer release()
+
+	addr := net.JoinHostPort(address, strconv.Itoa(port))
+	conn, err := dialBanner(ctx, addr)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"function": "GrabBanner",
+			"address":  hostname + ":" + strconv.Itoa(port),
+		}).Debugln(err)
+		return Banner{}, false
+	}
+	greeting := readBanner(conn)
+	conn.Close()
+	if len(greeting) > 0 {
+		b := classifyGreeting(greeting, port)
+		return b, b.Service != ""
+	}
+
+	probes := slices.Clone(helloProbes)
+	slices.SortStableFunc(probes, func(a, b helloProbe) int {
+		return boolToInt(slices.Contains(b.ports, port)) - boolToInt(slices.Contains(a.ports, port))
+	})
+	for _, probe := range probes {
+		if ctx.Err() != nil {
+			break
+		}
+		// services close connection on unexpected payload, every probe gets its own
+		if conn, err = dialBanner(ctx, addr); err != nil {
+			break
+		}
+		var resp []byte
+		if _, err = conn.Write(probe.request); err == nil {
+			resp = readBanner(conn)
+		}
+		if probe.match(resp) {
+			if probe.service == "mqtt" {
+				_, _ = conn.Write(mqttDisconnect)
+			}
+			conn.Close()
+			return Banner{Service: probe.service, Text: bannerText(resp)}, true
+		}
+		conn.Close()
+	}
+	return Banner{}, false
+}
+
+func dialBanner(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 1 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(bannerTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+func readBanner(conn net.Conn) []byte {
+	buf := make([]byte, 1024)
+	n, _ := conn.Read(buf)
+	return buf[:n]
+}
+
+// classifyGreeting names service by the first bytes it sent
+func classifyGreeting(b []byte, port int) Banner {
+	text := bannerText(b)
+	lower := strings.ToLower(text)
+	switch {
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		return Banner{Service: "ssh", Text: text}
+	case isMySQLHandshake(b):
+		return Banner{Service: "mysql", Text: mysqlVersion(b)}
+	case bytes.HasPrefix(b, []byte("220")):
+		switch {
+		case strings.Contains(lower, "ftp"):
+			return Banner{Service: "ftp", Text: text}
+		case strings.Contains(lower, "smtp") || strings.Contains(lower, "mail"):
+			return Banner{Service: "smtp", Text: text}
+		}
+		svc, _ := services.Name(ProtoTCP, port)
+		return Banner{Service: svc, Text: text}
+	case bytes.HasPrefix(b, []byte("+OK")):
+		return Banner{Service: "pop3", Text: text}
+	case bytes.HasPrefix(b, []byte("* OK")):
+		return Banner{Service: "imap", Text: text}
+	}
+	return Banner{Text: text}
+}
+
+// isMySQLHandshake checks for protocol 10 handshake or error packet
+// ("Host is not allowed to connect") with 3 byte length and sequence 0
+func isMySQLHandshake(b []byte) bool {
+	if len(b) < 5 || b[3] != 0 {
+		return false
+	}
+	length := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	return length > 0 && length <= len(b)-4 && (b[4] == 0x0a || b[4] == 0xff)
+}
+
+func mysqlVersion(b []byte) string {
+	if b[4] == 0xff {
+		// error code follows the marker, then message
+		if len(b) > 7 {
+			return bannerText(b[7:])
+		}
+		return ""
+	}
+	version, _, _ := bytes.Cut(b[5:], []byte{0})
+	return bannerText(version)
+}
+
+// bannerText returns first line of banner with printable characters only
+func bannerText(b []byte) string {
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	text := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, string(line))
+	if len(text) > bannerMaxLen {
+		text = text[:bannerMaxLen]
+	}
+	return strings.TrimSpace(text)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
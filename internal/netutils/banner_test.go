@@ -0,0 +1,186 @@
+package netutils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// mysqlPacket frames payload with 3 byte length and sequence 0
+func mysqlPacket(payload []byte) []byte {
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), 0x00}, payload...)
+}
+
+var (
+	// MySQL 8 handshake v10: version, thread id, salt, capabilities...
+	testMySQLHandshake = mysqlPacket([]byte("\x0a8.0.36-0ubuntu0.22.04.1\x00\x0b\x00\x00\x00\x1a\x3f\x5c\x01\x6b\x2d\x4e\x70\x00\xff\xff\xff\x02\x00\xff\xdf\x15\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x5e\x17\x28\x6c\x1f\x7a\x3b\x11\x62\x4d\x05\x2e\x00caching_sha2_password\x00"))
+	// error packet sent to clients of not allowed hosts: marker, code 1130, message
+	testMySQLDenied = mysqlPacket([]byte("\xff\x6a\x04Host '192.168.2.5' is not allowed to connect to this MySQL server"))
+)
+
+func TestClassifyGreeting(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting []byte
+		port     int
+		want     Banner
+	}{
+		{name: "ssh", greeting: []byte("SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u3\r\n"), port: 22,
+			want: Banner{Service: "ssh", Text: "SSH-2.0-OpenSSH_9.2p1 Debian-2+deb12u3"}},
+		{name: "ssh of dropbear on other port", greeting: []byte("SSH-2.0-dropbear_2022.83\r\n"), port: 2222,
+			want: Banner{Service: "ssh", Text: "SSH-2.0-dropbear_2022.83"}},
+		{name: "ftp", greeting: []byte("220 (vsFTPd 3.0.5)\r\n"), port: 21,
+			want: Banner{Service: "ftp", Text: "220 (vsFTPd 3.0.5)"}},
+		// first line does not name the service, port does
+		{name: "ftp of multi line greeting", greeting: []byte("220-FileZilla Server 1.8.0\r\n220 Please visit https://filezilla-project.org/\r\n"), port: 21,
+			want: Banner{Service: "ftp", Text: "220-FileZilla Server 1.8.0"}},
+		{name: "smtp", greeting: []byte("220 mail.hm.net ESMTP Postfix (Debian/GNU)\r\n"), port: 25,
+			want: Banner{Service: "smtp", Text: "220 mail.hm.net ESMTP Postfix (Debian/GNU)"}},
+		{name: "220 named by port", greeting: []byte("220 ready\r\n"), port: 21,
+			want: Banner{Service: "ftp", Text: "220 ready"}},
+		{name: "220 of unknown port", greeting: []byte("220 ready\r\n"), port: 60999,
+			want: Banner{Text: "220 ready"}},
+		{name: "pop3", greeting: []byte("+OK Dovecot ready.\r\n"), port: 110,
+			want: Banner{Service: "pop3", Text: "+OK Dovecot ready."}},
+		{name: "imap", greeting: []byte("* OK [CAPABILITY IMAP4rev1] Dovecot ready.\r\n"), port: 143,
+			want: Banner{Service: "imap", Text: "* OK [CAPABILITY IMAP4rev1] Dovecot ready."}},
+		{name: "mysql handshake", greeting: testMySQLHandshake, port: 3306,
+			want: Banner{Service: "mysql", Text: "8.0.36-0ubuntu0.22.04.1"}},
+		{name: "mysql host is not allowed", greeting: testMySQLDenied, port: 3306,
+			want: Banner{Service: "mysql", Text: "Host '192.168.2.5' is not allowed to connect to this MySQL server"}},
+		// packet length byte is printable, the rest of text is cut by protocol 10 (\n)
+		{name: "short mysql packet", greeting: testMySQLHandshake[:12], port: 3306,
+			want: Banner{Text: "["}},
+		{name: "binary", greeting: []byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x0a}, port: 443},
+		{name: "garbage with text", greeting: []byte("\x00\x00\x00\x00\x01\xfeHELLO\x7f"), port: 9999,
+			want: Banner{Text: "HELLO"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyGreeting(tt.greeting, tt.port); got != tt.want {
+				t.Errorf("classifyGreeting = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMySQLHandshake(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want bool
+	}{
+		{name: "handshake v10", b: testMySQLHandshake, want: true},
+		{name: "error packet", b: testMySQLDenied, want: true},
+		{name: "minimal packet", b: []byte{0x01, 0x00, 0x00, 0x00, 0x0a}, want: true},
+		{name: "packet longer than read", b: testMySQLHandshake[:20]},
+		{name: "header only", b: []byte{0x4a, 0x00, 0x00, 0x00}},
+		{name: "empty", b: nil},
+		{name: "zero length", b: []byte{0x00, 0x00, 0x00, 0x00, 0x0a}},
+		{name: "sequence is not 0", b: []byte{0x01, 0x00, 0x00, 0x01, 0x0a}},
+		{name: "protocol 9", b: mysqlPacket([]byte("\x095.0.0\x00"))},
+		{name: "text", b: []byte("SSH-2.0-OpenSSH_9.2p1\r\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMySQLHandshake(tt.b); got != tt.want {
+				t.Errorf("isMySQLHandshake = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMySQLVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{name: "mysql", b: testMySQLHandshake, want: "8.0.36-0ubuntu0.22.04.1"},
+		{name: "mariadb", b: mysqlPacket([]byte("\x0a5.5.5-10.11.6-MariaDB-0+deb12u1\x00\x2a\x00\x00\x00")), want: "5.5.5-10.11.6-MariaDB-0+deb12u1"},
+		{name: "error message", b: testMySQLDenied, want: "Host '192.168.2.5' is not allowed to connect to this MySQL server"},
+		{name: "error without message", b: mysqlPacket([]byte("\xff\x6a\x04")), want: ""},
+		{name: "version without terminator", b: []byte{0x06, 0x00, 0x00, 0x00, 0x0a, '8', '.', '0'}, want: "8.0"},
+		{name: "no version", b: []byte{0x01, 0x00, 0x00, 0x00, 0x0a}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mysqlVersion(tt.b); got != tt.want {
+				t.Errorf("mysqlVersion = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMQTTConnect(t *testing.T) {
+	want := []byte{
+		// CONNECT, remaining length
+		0x10, 0x15,
+		// protocol name, level 4 (3.1.1), clean session, keep alive 60s
+		0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c,
+		// client id
+		0x00, 0x09, 'c', 'h', 'd', '-', 'p', 'r', 'o', 'b', 'e',
+	}
+	if got := mqttConnect("chd-probe"); !bytes.Equal(got, want) {
+		t.Errorf("mqttConnect = % x, want % x", got, want)
+	}
+	if got := mqttConnect(""); !bytes.Equal(got, []byte{0x10, 0x0c, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c, 0x00, 0x00}) {
+		t.Errorf("mqttConnect with empty id = % x", got)
+	}
+}
+
+func TestHelloProbesMatch(t *testing.T) {
+	probes := make(map[string]helloProbe)
+	for _, p := range helloProbes {
+		probes[p.service] = p
+	}
+	tests := []struct {
+		service string
+		resp    []byte
+		want    bool
+	}{
+		{"redis", []byte("+PONG\r\n"), true},
+		{"redis", []byte("-NOAUTH Authentication required.\r\n"), true},
+		{"redis", []byte("-DENIED Redis is running in protected mode\r\n"), true},
+		{"redis", []byte("HTTP/1.1 400 Bad Request\r\n"), false},
+		{"postgresql", []byte("N"), true},
+		{"postgresql", []byte("S"), true},
+		{"postgresql", []byte("E"), false},
+		{"postgresql", []byte("NO"), false},
+		// CONNACK accepted and not authorized
+		{"mqtt", []byte{0x20, 0x02, 0x00, 0x00}, true},
+		{"mqtt", []byte{0x20, 0x02, 0x00, 0x05}, true},
+		{"mqtt", []byte{0x20, 0x02}, false},
+		{"mqtt", []byte{0x30, 0x02, 0x00, 0x00}, false},
+		{"mqtt", nil, false},
+	}
+	for _, tt := range tests {
+		if got := probes[tt.service].match(tt.resp); got != tt.want {
+			t.Errorf("%s match(%q) = %v, want %v", tt.service, tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestBannerText(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{name: "first line", b: []byte("220-FileZilla Server\r\n220 ready\r\n"), want: "220-FileZilla Server"},
+		{name: "spaces are trimmed", b: []byte("  +OK ready \r\n"), want: "+OK ready"},
+		{name: "control characters", b: []byte("SSH-2.0-\x00\x1bOpenSSH\t9\r\n"), want: "SSH-2.0-OpenSSH9"},
+		{name: "non ascii", b: []byte("220 сервер ready"), want: "220  ready"},
+		{name: "binary", b: []byte{0x00, 0xff, 0xfe, 0x80}, want: ""},
+		{name: "empty", b: nil, want: ""},
+		{name: "long", b: []byte(strings.Repeat("a", 300)), want: strings.Repeat("a", bannerMaxLen)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bannerText(tt.b); got != tt.want {
+				t.Errorf("bannerText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package netutils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// lease file formats
+const (
+	LeasesDnsmasq = "dnsmasq"
+	LeasesISC     = "isc"
+)
+
+/*
+LoadDHCPLeases reads active leases and returns them as inventory.
+
+	ctx - cancels download of http(s) source
+	source - lease file path or http(s) url
+	format - dnsmasq or isc, detected by content if empty
+*/
+func LoadDHCPLeases(ctx context.Context, source, format string) (Inventory, error) {
+	b, err := readSource(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read dhcp leases from %s, %w", source, err)
+	}
+
+	if format == "" {
+		format = LeasesDnsmasq
+		if bytes.Contains(b, []byte("lease ")) && bytes.Contains(b, []byte("{")) {
+			format = LeasesISC
+		}
+	}
+
+	var hosts []Host
+	switch format {
+	case LeasesDnsmasq:
+		hosts = parseDnsmasqLeases(b, time.Now())
+	case LeasesISC:
+		hosts = parseISCLeases(b, time.Now())
+	default:
+		return nil, fmt.Errorf("unknown dhcp leases format %s", format)
+	}
+	logger.WithFields(logger.Fields{
+		"function": "LoadDHCPLeases",
+		"source":   source,
+		"format":   format,
+	}).Debugf("Found %d active leases", len(hosts))
+
+	inv := make(Inventory, len(hosts))
+	for _, h := range hosts {
+		h.Source = SourceDHCP
+		inv.Add(h)
+	}
+	return inv, nil
+}
+
+func readSource(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected http status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseDnsmasqLeases parses lines like "<expiry> <mac> <ip> <hostname|*> <client-id|*>",
+// expiry 0 means infinite lease
+func parseDnsmasqLeases(b []byte, now time.Time) []Host {
+	var hosts []Host
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || fields[0] == "duid" {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || (expiry != 0 && expiry < now.Unix()) {
+			continue
+		}
+		if net.ParseIP(fields[2]) == nil {
+			continue
+		}
+		h := Host{IP: fields[2]}
+		if mac, err := net.ParseMAC(fields[1]); err == nil {
+			h.MAC = mac.String()
+		}
+		if fields[3] != "*" {
+			h.Hostname = fields[3]
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// parseISCLeases parses dhcpd.leases blocks, the last block of an address wins.
+// Leases which are not active or ended before now are skipped
+func parseISCLeases(b []byte, now time.Time) []Host {
+	leases := make(map[string]*Host)
+	// order of first appearance, address may turn active again after it was freed
+	var order []string
+	listed := make(map[string]bool)
+	var cur *Host
+	active := true
+	var ends time.Time
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(line, ";"))
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "lease" && len(fields) >= 2:
+			cur = &Host{IP: fields[1]}
+			active = true
+			ends = time.Time{}
+		case cur == nil:
+			continue
+		case fields[0] == "}":
+			if active && (ends.IsZero() || ends.After(now)) && net.ParseIP(cur.IP) != nil {
+				if !listed[cur.IP] {
+					listed[cur.IP] = true
+					order = append(order, cur.IP)
+				}
+				leases[cur.IP] = cur
+			} else {
+				delete(leases, cur.IP)
+			}
+			cur = nil
+		case fields[0] == "binding" && len(fields) >= 3 && fields[1] == "state":
+			active = fields[2] == "active"
+		case fields[0] == "ends":
+			ends = parseISCTime(fields[1:])
+		case fields[0] == "hardware" && len(fields) >= 3:
+			if mac, err := net.ParseMAC(fields[2]); err == nil {
+				cur.MAC = mac.String()
+			}
+		case fields[0] == "client-hostname" && len(fields) >= 2:
+			cur.Hostname = strings.Trim(strings.Join(fields[1:], " "), `"`)
+		}
+	}
+
+	var hosts []Host
+	for _, ip := range order {
+		if h, ok := leases[ip]; ok {
+			hosts = append(hosts, *h)
+		}
+	}
+	return hosts
+}
+
+/*
+parseISCTime parses lease time, zero time means no end:
+
+	never
+	epoch 1714564800; # Wed May 01 12:00:00 2024
+	4 2024/05/01 12:00:00 - weekday, date and time in UTC
+*/
+func parseISCTime(fields []string) time.Time {
+	switch {
+	case len(fields) == 0 || fields[0] == "never":
+		return time.Time{}
+	case fields[0] == "epoch" && len(fields) >= 2:
+		sec, err := strconv.ParseInt(strings.TrimSuffix(fields[1], ";"), 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.Unix(sec, 0)
+	case len(fields) >= 3:
+		t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2])
+		if err != nil {
+			return time.Time{}
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,174 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testLeaseNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParseDnsmasqLeases(t *testing.T) {
+	leases := `1714568400 aa:bb:cc:dd:ee:01 192.168.2.10 cam1 01:aa:bb:cc:dd:ee:01
+0 AA-BB-CC-DD-EE-02 192.168.2.11 * *
+1714550400 aa:bb:cc:dd:ee:03 192.168.2.12 expired *
+1714568400 aa:bb:cc:dd:ee:04 2001:db8::10 v6host *
+duid 00:01:00:01:2c:5f:aa:bb:cc:dd:ee:ff
+1714568400 aa:bb:cc:dd:ee:05 not-an-ip broken *
+1714568400 aa:bb:cc:dd:ee:06
+never aa:bb:cc:dd:ee:07 192.168.2.13 bad-expiry *
+
+`
+	want := []Host{
+		{IP: "192.168.2.10", MAC: "aa:bb:cc:dd:ee:01", Hostname: "cam1"},
+		{IP: "192.168.2.11", MAC: "aa:bb:cc:dd:ee:02"},
+		{IP: "2001:db8::10", MAC: "aa:bb:cc:dd:ee:04", Hostname: "v6host"},
+	}
+	if got := parseDnsmasqLeases([]byte(leases), testLeaseNow); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDnsmasqLeases = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseISCLeases(t *testing.T) {
+	tests := []struct {
+		name   string
+		leases string
+		want   []Host
+	}{
+		{name: "active lease", leases: `
+# dhcpd.leases
+lease 192.168.2.20 {
+  starts 3 2024/05/01 10:00:00;
+  ends 3 2024/05/01 14:00:00;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:20;
+  client-hostname "plug-20";
+}`, want: []Host{{IP: "192.168.2.20", MAC: "aa:bb:cc:dd:ee:20", Hostname: "plug-20"}}},
+		{name: "expired lease", leases: `
+lease 192.168.2.21 {
+  ends 3 2024/05/01 11:59:59;
+  binding state active;
+}`},
+		{name: "epoch and never ends", leases: `
+lease 192.168.2.22 {
+  ends epoch 1714568400; # Wed May 01 13:00:00 2024
+  binding state active;
+}
+lease 192.168.2.23 {
+  ends epoch 1714564000; # Wed May 01 11:46:40 2024
+  binding state active;
+}
+lease 192.168.2.24 {
+  ends never;
+}`, want: []Host{{IP: "192.168.2.22"}, {IP: "192.168.2.24"}}},
+		{name: "last block wins", leases: `
+lease 192.168.2.25 {
+  binding state active;
+  client-hostname "old";
+}
+lease 192.168.2.26 {
+  binding state active;
+}
+lease 192.168.2.25 {
+  binding state free;
+}
+lease 192.168.2.26 {
+  binding state active;
+  client-hostname "new";
+}`, want: []Host{{IP: "192.168.2.26", Hostname: "new"}}},
+		{name: "active again after free", leases: `
+lease 192.168.2.28 {
+  binding state active;
+}
+lease 192.168.2.29 {
+  binding state active;
+}
+lease 192.168.2.28 {
+  binding state free;
+}
+lease 192.168.2.28 {
+  binding state active;
+  client-hostname "back";
+}`, want: []Host{{IP: "192.168.2.28", Hostname: "back"}, {IP: "192.168.2.29"}}},
+		{name: "malformed lines", leases: `
+;
+lease
+  binding state active;
+lease 192.168.2.27 {
+  ;
+  hardware ethernet;
+  ends;
+}
+lease not-an-ip {
+}`, want: []Host{{IP: "192.168.2.27"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseISCLeases([]byte(tt.leases), testLeaseNow); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseISCLeases = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDHCPLeases(t *testing.T) {
+	isc := "lease 192.168.2.30 {\n  binding state active;\n  client-hostname \"tv\";\n}\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dhcpd.leases" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(isc))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name, source, format string
+		want                 []string
+		wantErr              bool
+	}{
+		{name: "dnsmasq file", source: writeTestFile(t, "dnsmasq.leases", "0 aa:bb:cc:dd:ee:01 192.168.2.10 cam1 *\n"), want: []string{"192.168.2.10"}},
+		{name: "isc detected by content", source: writeTestFile(t, "dhcpd.leases", isc), want: []string{"192.168.2.30"}},
+		{name: "isc over http", source: srv.URL + "/dhcpd.leases", format: LeasesISC, want: []string{"192.168.2.30"}},
+		{name: "http error", source: srv.URL + "/missing", wantErr: true},
+		{name: "unknown format", source: writeTestFile(t, "leases", ""), format: "kea", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := LoadDHCPLeases(context.Background(), tt.source, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(inv) != len(tt.want) {
+				t.Fatalf("loaded %d hosts, want %d", len(inv), len(tt.want))
+			}
+			for _, ip := range tt.want {
+				if h, ok := inv[ip]; !ok || h.Source != SourceDHCP {
+					t.Errorf("host %s = %+v, want dhcp host", ip, h)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadDHCPLeasesCancel(t *testing.T) {
+	// server of leases hangs until the request is cancelled
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := LoadDHCPLeases(ctx, srv.URL+"/dhcpd.leases", LeasesISC); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled load returned after %v", elapsed)
+	}
+}
@@ -0,0 +1,324 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	logger "github.com/sirupsen/logrus"
+)
+
+// DNSRecord is a single resource record received from a zone transfer
+type DNSRecord struct {
+	Name  string
+	Type  string
+	TTL   uint32
+	Value string
+}
+
+// TSIGKey describes transfer credentials, Algorithm is hmac-sha256 by default
+type TSIGKey struct {
+	Name      string
+	Secret    string
+	Algorithm string
+}
+
+// ZoneTransfer is a native AXFR/IXFR client
+type ZoneTransfer struct {
+	Server  string
+	Port    int
+	TSIG    *TSIGKey
+	Timeout time.Duration
+}
+
+/*
+server - authoritative dns server, first nameserver from /etc/resolv.conf if empty
+port - dns server port, 53 by default
+tsig - transfer key, may be nil
+*/
+func NewZoneTransfer(server string, port int, tsig *TSIGKey) *ZoneTransfer {
+	if port == 0 {
+		port = 53
+	}
+	return &ZoneTransfer{
+		Server:  server,
+		Port:    port,
+		TSIG:    tsig,
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (z *ZoneTransfer) address() (string, error) {
+	server := z.Server
+	if server == "" {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return "", fmt.Errorf("unable to get dns server from resolv.conf, %w", err)
+		}
+		if len(conf.Servers) == 0 {
+			return "", fmt.Errorf("no nameservers in resolv.conf")
+		}
+		server = conf.Servers[0]
+	}
+	return net.JoinHostPort(server, strconv.Itoa(z.Port)), nil
+}
+
+// ZoneDiff is a result of incremental zone transfer
+type ZoneDiff struct {
+	// Serial is the current serial of zone on server
+	Serial uint32
+	// Full is set when server sent the whole zone instead of differences, Added holds the zone then
+	Full    bool
+	Deleted []DNSRecord
+	Added   []DNSRecord
+}
+
+// AXFR makes full zone transfer, it is stopped when ctx is done
+func (z *ZoneTransfer) AXFR(ctx context.Context, zone string) ([]DNSRecord, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(dns.Fqdn(zone))
+	rrs, err := z.transfer(ctx, zone, m)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]DNSRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		records = append(records, newDNSRecord(rr))
+	}
+	return records, nil
+}
+
+// IXFR makes incremental zone transfer starting from serial, deleted and added
+// records of all difference sequences are returned in the order server sent them
+func (z *ZoneTransfer) IXFR(ctx context.Context, zone string, serial uint32) (*ZoneDiff, error) {
+	m := new(dns.Msg)
+	m.SetIxfr(dns.Fqdn(zone), serial, ".", ".")
+	rrs, err := z.transfer(ctx, zone, m)
+	if err != nil {
+		return nil, err
+	}
+	return parseIXFR(rrs)
+}
+
+/*
+parseIXFR splits answer of IXFR (RFC 1995) into deleted and added records:
+
+	SOA(new)                          - zone is up to date
+	SOA(new) records... SOA(new)      - full zone, like AXFR
+	SOA(new) SOA(old) deleted... SOA(next) added... ... SOA(new)
+*/
+func parseIXFR(rrs []dns.RR) (*ZoneDiff, error) {
+	if len(rrs) == 0 {
+		return nil, errors.New("empty IXFR response")
+	}
+	soa, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, errors.New("IXFR response does not start with SOA")
+	}
+	diff := &ZoneDiff{Serial: soa.Serial}
+	if len(rrs) == 1 {
+		return diff, nil
+	}
+	last, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok || last.Serial != soa.Serial {
+		return nil, errors.New("IXFR response does not end with SOA of current serial")
+	}
+	if _, ok := rrs[1].(*dns.SOA); !ok {
+		diff.Full = true
+		for _, rr := range rrs[:len(rrs)-1] {
+			diff.Added = append(diff.Added, newDNSRecord(rr))
+		}
+		return diff, nil
+	}
+
+	// SOA opens deletions of a sequence, the next one opens its additions
+	deleting := false
+	for _, rr := range rrs[1 : len(rrs)-1] {
+		if _, ok := rr.(*dns.SOA); ok {
+			deleting = !deleting
+			continue
+		}
+		if deleting {
+			diff.Deleted = append(diff.Deleted, newDNSRecord(rr))
+		} else {
+			diff.Added = append(diff.Added, newDNSRecord(rr))
+		}
+	}
+	return diff, nil
+}
+
+func (z *ZoneTransfer) transfer(ctx context.Context, zone string, m *dns.Msg) ([]dns.RR, error) {
+	addr, err := z.address()
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: z.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("zone transfer of %s from %s failed, %w", zone, addr, err)
+	}
+	defer conn.Close()
+	// dns.Transfer can not be cancelled, closing its connection breaks reading of the transfer
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	t := &dns.Transfer{
+		Conn:         &dns.Conn{Conn: conn},
+		ReadTimeout:  z.Timeout,
+		WriteTimeout: z.Timeout,
+	}
+	if z.TSIG != nil {
+		algorithm := z.TSIG.Algorithm
+		if algorithm == "" {
+			algorithm = dns.HmacSHA256
+		}
+		name := dns.Fqdn(z.TSIG.Name)
+		t.TsigSecret = map[string]string{name: z.TSIG.Secret}
+		m.SetTsig(name, dns.Fqdn(algorithm), 300, time.Now().Unix())
+	}
+
+	env, err := t.In(m, addr)
+	if err != nil {
+		return nil, fmt.Errorf("zone transfer of %s from %s failed, %w", zone, addr, err)
+	}
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			if ctx.Err() != nil {
+				e.Error = ctx.Err()
+			}
+			return nil, fmt.Errorf("zone transfer of %s from %s failed, %w", zone, addr, e.Error)
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	logger.WithFields(logger.Fields{
+		"function": "transfer",
+		"zone":     zone,
+		"server":   addr,
+	}).Debugf("Received %d records", len(rrs))
+
+	return rrs, nil
+}
+
+func newDNSRecord(rr dns.RR) DNSRecord {
+	h := rr.Header()
+	rec := DNSRecord{
+		Name: strings.TrimSuffix(h.Name, "."),
+		Type: dns.TypeToString[h.Rrtype],
+		TTL:  h.Ttl,
+	}
+	switch v := rr.(type) {
+	case *dns.A:
+		rec.Value = v.A.String()
+	case *dns.AAAA:
+		rec.Value = v.AAAA.String()
+	case *dns.CNAME:
+		rec.Value = strings.TrimSuffix(v.Target, ".")
+	case *dns.PTR:
+		rec.Value = strings.TrimSuffix(v.Ptr, ".")
+	default:
+		// strip header part from text presentation
+		rec.Value = strings.TrimPrefix(rr.String(), h.String())
+	}
+	return rec
+}
+
+// DNSZone is a zone to discover hosts from with its own transfer settings
+type DNSZone struct {
+	Name   string
+	Server string
+	Port   int
+	TSIG   *TSIGKey
+}
+
+// Hosts transfers the zone and returns hosts from A/AAAA records,
+// or from PTR records for reverse zones
+func (z DNSZone) Hosts(ctx context.Context) ([]Host, error) {
+	records, err := NewZoneTransfer(z.Server, z.Port, z.TSIG).AXFR(ctx, z.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []Host
+	for _, rec := range records {
+		switch rec.Type {
+		case "A", "AAAA":
+			hosts = append(hosts, Host{Hostname: rec.Name, IP: rec.Value, Zone: z.Name, Source: SourceDNS})
+		case "PTR":
+			ip := ptrToIP(rec.Name)
+			if ip == "" {
+				continue
+			}
+			hosts = append(hosts, Host{Hostname: rec.Value, IP: ip, Zone: z.Name, Source: SourceDNS})
+		}
+	}
+	return hosts, nil
+}
+
+// GetDNSZonesInfo transfers every zone and merges hosts into one inventory.
+// Failed zones are skipped, their errors are returned joined
+func GetDNSZonesInfo(ctx context.Context, zones []DNSZone) (Inventory, error) {
+	inv := make(Inventory)
+	var errs []error
+	for _, z := range zones {
+		hosts, err := z.Hosts(ctx)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"function": "GetDNSZonesInfo",
+				"zone":     z.Name,
+				"server":   z.Server,
+			}).Errorln(err)
+			errs = append(errs, err)
+			continue
+		}
+		for _, h := range hosts {
+			inv.Add(h)
+		}
+	}
+	return inv, errors.Join(errs...)
+}
+
+// ptrToIP converts reverse zone name to ip address, empty string if name is not a reverse one
+func ptrToIP(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != 4 {
+			return ""
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		ip := net.ParseIP(strings.Join(labels, "."))
+		if ip == nil {
+			return ""
+		}
+		return ip.String()
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		nibbles := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(nibbles) != 32 {
+			return ""
+		}
+		var b strings.Builder
+		for i := len(nibbles) - 1; i >= 0; i-- {
+			b.WriteString(nibbles[i])
+			if i%4 == 0 && i != 0 {
+				b.WriteByte(':')
+			}
+		}
+		ip := net.ParseIP(b.String())
+		if ip == nil {
+			return ""
+		}
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,280 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testZone       = "example.test."
+	testTSIGName   = "xfr-key."
+	testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+)
+
+func testRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func testSOA(t *testing.T, serial uint32) dns.RR {
+	return testRR(t, testZone+" 3600 IN SOA ns.example.test. admin.example.test. "+strconv.Itoa(int(serial))+" 3600 600 86400 60")
+}
+
+// testZoneServer serves testZone over tcp, serial 1 -> 2 deletes old.example.test
+// and adds new.example.test, serial 2 is current. Transfers require TSIG if requireTSIG is set
+func testZoneServer(t *testing.T, requireTSIG bool) int {
+	t.Helper()
+	zone := []dns.RR{
+		testSOA(t, 2),
+		testRR(t, "host1.example.test. 300 IN A 192.168.2.10"),
+		testRR(t, "host2.example.test. 600 IN AAAA 2001:db8::2"),
+		testRR(t, "new.example.test. 300 IN A 192.168.2.30"),
+		testRR(t, "www.example.test. 300 IN CNAME host1.example.test."),
+		testSOA(t, 2),
+	}
+	ixfr := []dns.RR{
+		testSOA(t, 2),
+		testSOA(t, 1),
+		testRR(t, "old.example.test. 300 IN A 192.168.2.20"),
+		testSOA(t, 2),
+		testRR(t, "new.example.test. 300 IN A 192.168.2.30"),
+		testSOA(t, 2),
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if requireTSIG && (r.IsTsig() == nil || w.TsigStatus() != nil) {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			_ = w.WriteMsg(m)
+			return
+		}
+		rrs := zone
+		if r.Question[0].Qtype == dns.TypeIXFR {
+			switch r.Ns[0].(*dns.SOA).Serial {
+			case 1:
+				rrs = ixfr
+			case 2:
+				rrs = zone[:1]
+			}
+		}
+		// send records in two messages to check reassembly
+		ch := make(chan *dns.Envelope)
+		go func() {
+			half := (len(rrs) + 1) / 2
+			ch <- &dns.Envelope{RR: rrs[:half]}
+			if half < len(rrs) {
+				ch <- &dns.Envelope{RR: rrs[half:]}
+			}
+			close(ch)
+		}()
+		if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+			t.Log(err)
+		}
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		Listener:          l,
+		Net:               "tcp",
+		Handler:           handler,
+		TsigSecret:        map[string]string{testTSIGName: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func recordNames(records []DNSRecord) []string {
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Type+" "+r.Name+" "+r.Value)
+	}
+	return names
+}
+
+func TestAXFR(t *testing.T) {
+	port := testZoneServer(t, false)
+	records, err := NewZoneTransfer("127.0.0.1", port, nil).AXFR(context.Background(), "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DNSRecord{
+		{Name: "host1.example.test", Type: "A", TTL: 300, Value: "192.168.2.10"},
+		{Name: "host2.example.test", Type: "AAAA", TTL: 600, Value: "2001:db8::2"},
+		{Name: "new.example.test", Type: "A", TTL: 300, Value: "192.168.2.30"},
+		{Name: "www.example.test", Type: "CNAME", TTL: 300, Value: "host1.example.test"},
+	}
+	// both SOA records of the transfer are returned
+	if len(records) != len(want)+2 || records[0].Type != "SOA" || records[len(records)-1].Type != "SOA" {
+		t.Fatalf("AXFR records = %v", recordNames(records))
+	}
+	if got := records[1 : len(records)-1]; !slices.Equal(got, want) {
+		t.Errorf("AXFR records = %+v, want %+v", got, want)
+	}
+}
+
+func TestIXFR(t *testing.T) {
+	port := testZoneServer(t, false)
+	zt := NewZoneTransfer("127.0.0.1", port, nil)
+
+	tests := []struct {
+		name    string
+		serial  uint32
+		full    bool
+		deleted []string
+		added   []string
+	}{
+		{name: "differences", serial: 1,
+			deleted: []string{"A old.example.test 192.168.2.20"},
+			added:   []string{"A new.example.test 192.168.2.30"}},
+		{name: "up to date", serial: 2},
+		{name: "unknown serial falls back to full zone", serial: 0, full: true,
+			added: []string{
+				"SOA example.test ns.example.test. admin.example.test. 2 3600 600 86400 60",
+				"A host1.example.test 192.168.2.10",
+				"AAAA host2.example.test 2001:db8::2",
+				"A new.example.test 192.168.2.30",
+				"CNAME www.example.test host1.example.test",
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := zt.IXFR(context.Background(), "example.test", tt.serial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff.Serial != 2 || diff.Full != tt.full {
+				t.Errorf("serial = %d, full = %v, want 2, %v", diff.Serial, diff.Full, tt.full)
+			}
+			if got := recordNames(diff.Deleted); !slices.Equal(got, tt.deleted) {
+				t.Errorf("deleted = %q, want %q", got, tt.deleted)
+			}
+			if got := recordNames(diff.Added); !slices.Equal(got, tt.added) {
+				t.Errorf("added = %q, want %q", got, tt.added)
+			}
+		})
+	}
+}
+
+func TestTransferTSIG(t *testing.T) {
+	port := testZoneServer(t, true)
+
+	tests := []struct {
+		name    string
+		tsig    *TSIGKey
+		wantErr bool
+	}{
+		{name: "valid key", tsig: &TSIGKey{Name: "xfr-key", Secret: testTSIGSecret}},
+		{name: "no key", wantErr: true},
+		{name: "wrong secret", tsig: &TSIGKey{Name: "xfr-key", Secret: "d3Jvbmc="}, wantErr: true},
+		{name: "unknown key", tsig: &TSIGKey{Name: "other-key", Secret: testTSIGSecret}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zt := NewZoneTransfer("127.0.0.1", port, tt.tsig)
+			records, err := zt.AXFR(context.Background(), "example.test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AXFR error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(records) != 6 {
+				t.Errorf("AXFR returned %d records, want 6", len(records))
+			}
+			diff, err := zt.IXFR(context.Background(), "example.test", 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IXFR error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (len(diff.Deleted) != 1 || len(diff.Added) != 1) {
+				t.Errorf("IXFR deleted %v, added %v", recordNames(diff.Deleted), recordNames(diff.Added))
+			}
+		})
+	}
+}
+
+func TestTransferCancel(t *testing.T) {
+	// server accepts connections and never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	zt := NewZoneTransfer("127.0.0.1", l.Addr().(*net.TCPAddr).Port, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err = zt.AXFR(ctx, "example.test"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AXFR error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled AXFR returned after %v of %v timeout", elapsed, zt.Timeout)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = zt.IXFR(ctx, "example.test", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("IXFR error = %v, want canceled", err)
+	}
+	if _, err = GetDNSZonesInfo(ctx, []DNSZone{{Name: "example.test", Server: "127.0.0.1", Port: zt.Port}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetDNSZonesInfo error = %v, want canceled", err)
+	}
+}
+
+func TestParseIXFRErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rrs  []dns.RR
+	}{
+		{name: "empty"},
+		{name: "no leading SOA", rrs: []dns.RR{testRR(t, "a.example.test. 300 IN A 192.0.2.1")}},
+		{name: "truncated", rrs: []dns.RR{testSOA(t, 2), testSOA(t, 1), testRR(t, "a.example.test. 300 IN A 192.0.2.1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff, err := parseIXFR(tt.rrs); err == nil {
+				t.Errorf("parseIXFR = %+v, want error", diff)
+			}
+		})
+	}
+}
+
+func TestPtrToIP(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"10.2.168.192.in-addr.arpa.", "192.168.2.10"},
+		{"2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", "2001:db8::2"},
+		{"2.168.192.in-addr.arpa", ""},
+		{"host.example.test", ""},
+	}
+	for _, tt := range tests {
+		if got := ptrToIP(tt.name); got != tt.want {
+			t.Errorf("ptrToIP(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
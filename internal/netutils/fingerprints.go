@@ -0,0 +1,185 @@
+package netutils
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed fingerprints.yaml
+var builtinFingerprints []byte
+
+// Fingerprint recognizes service by http response, all set conditions must match
+type Fingerprint struct {
+	Service string `yaml:"service"`
+	// Exporter is exporter type for prometheus exporters, empty otherwise
+	Exporter string `yaml:"exporter"`
+	// MetricsPath is metrics endpoint of exporter, /metrics by default
+	MetricsPath string   `yaml:"metrics_path"`
+	Tags        []string `yaml:"tags"`
+
+	Path    string            `yaml:"path"`
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Title   string            `yaml:"title"`
+	Body    string            `yaml:"body"`
+	Port    []int             `yaml:"port"`
+
+	headers map[string]*regexp.Regexp
+	title   *regexp.Regexp
+	body    *regexp.Regexp
+}
+
+// httpResponse is a response fingerprints are matched against
+type httpResponse struct {
+	status  int
+	headers http.Header
+	title   string
+	body    string
+	// elapsed is time to response headers
+	elapsed time.Duration
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// httpFingerprints are checked in order by HTTPProber
+var httpFingerprints = mustParseFingerprints(builtinFingerprints)
+
+/*
+LoadFingerprints reads fingerprint rules from yaml file, they are checked before built-in ones.
+Rules of a previous call are replaced:
+
+	fingerprints:
+	  - service: shelly
+	    path: /shelly
+	    status: 200
+	    headers: {Content-Type: json}
+	    body: '"type":"SH'
+	    tags: [smarthome, relay]
+*/
+func LoadFingerprints(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read fingerprints file %s, %w", path, err)
+	}
+	fps, err := parseFingerprints(b)
+	if err != nil {
+		return fmt.Errorf("unable to parse fingerprints file %s, %w", path, err)
+	}
+	httpFingerprints = append(fps, mustParseFingerprints(builtinFingerprints)...)
+	return nil
+}
+
+func mustParseFingerprints(b []byte) []Fingerprint {
+	fps, err := parseFingerprints(b)
+	if err != nil {
+		panic(err)
+	}
+	return fps
+}
+
+func parseFingerprints(b []byte) ([]Fingerprint, error) {
+	var doc struct {
+		Fingerprints []Fingerprint `yaml:"fingerprints"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	var errs []error
+	for i := range doc.Fingerprints {
+		if err := doc.Fingerprints[i].compile(); err != nil {
+			errs = append(errs, fmt.Errorf("fingerprint %d (%s): %w", i+1, doc.Fingerprints[i].Service, err))
+		}
+	}
+	return doc.Fingerprints, errors.Join(errs...)
+}
+
+func (f *Fingerprint) compile() error {
+	if f.Service == "" {
+		return errors.New("service is not set")
+	}
+	if f.Status == 0 && len(f.Headers) == 0 && f.Title == "" && f.Body == "" && len(f.Port) == 0 {
+		return errors.New("no conditions")
+	}
+	if f.Exporter != "" && f.MetricsPath == "" {
+		f.MetricsPath = "/metrics"
+	}
+	if !strings.HasPrefix(f.Path, "/") {
+		f.Path = "/" + f.Path
+	}
+	var err error
+	if f.Title != "" {
+		if f.title, err = regexp.Compile(f.Title); err != nil {
+			return err
+		}
+	}
+	if f.Body != "" {
+		if f.body, err = regexp.Compile(f.Body); err != nil {
+			return err
+		}
+	}
+	f.headers = make(map[string]*regexp.Regexp, len(f.Headers))
+	for name, expr := range f.Headers {
+		if f.headers[name], err = regexp.Compile(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match returns evidence if response matches all conditions
+func (f *Fingerprint) match(port int, resp *httpResponse) (string, bool) {
+	var evidence []string
+	if f.Path != "/" {
+		evidence = append(evidence, "path "+f.Path)
+	}
+	if len(f.Port) > 0 {
+		if !slices.Contains(f.Port, port) {
+			return "", false
+		}
+		evidence = append(evidence, "port "+strconv.Itoa(port))
+	}
+	if f.Status != 0 {
+		if resp.status != f.Status {
+			return "", false
+		}
+		evidence = append(evidence, "status "+strconv.Itoa(f.Status))
+	}
+	for _, name := range slices.Sorted(maps.Keys(f.headers)) {
+		if !f.headers[name].MatchString(resp.headers.Get(name)) {
+			return "", false
+		}
+		evidence = append(evidence, "header "+name+" ~ "+strconv.Quote(f.Headers[name]))
+	}
+	if f.title != nil {
+		if !f.title.MatchString(resp.title) {
+			return "", false
+		}
+		evidence = append(evidence, "title ~ "+strconv.Quote(f.Title))
+	}
+	if f.body != nil {
+		if !f.body.MatchString(resp.body) {
+			return "", false
+		}
+		evidence = append(evidence, "body ~ "+strconv.Quote(f.Body))
+	}
+	return strings.Join(evidence, ", "), true
+}
+
+func htmlTitle(body string) string {
+	m := titleRe.FindStringSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[1])
+}
@@ -0,0 +1,221 @@
+package netutils
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testResponse(status int, headers map[string]string, body string) *httpResponse {
+	h := make(http.Header)
+	for name, value := range headers {
+		h.Set(name, value)
+	}
+	return &httpResponse{status: status, headers: h, title: htmlTitle(body), body: body}
+}
+
+// firstMatch returns first rule matching response of its path the way HTTPProber checks them
+func firstMatch(fps []Fingerprint, port int, responses map[string]*httpResponse) (*Fingerprint, string) {
+	for i := range fps {
+		f := &fps[i]
+		resp, ok := responses[f.Path]
+		if !ok {
+			continue
+		}
+		if evidence, ok := f.match(port, resp); ok {
+			return f, evidence
+		}
+	}
+	return nil, ""
+}
+
+func TestBuiltinFingerprints(t *testing.T) {
+	fps, err := parseFingerprints(builtinFingerprints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) == 0 {
+		t.Fatal("no built-in fingerprints")
+	}
+
+	tests := []struct {
+		name        string
+		port        int
+		body        string
+		service     string
+		exporter    string
+		metricsPath string
+	}{
+		{name: "node exporter landing page", port: 9100, body: "<html><head><title>Node Exporter</title></head></html>",
+			service: "node_exporter", exporter: "node_exporter", metricsPath: "/metrics"},
+		{name: "consul exporter on other port", port: 19107, body: "<h1>Consul Exporter</h1>",
+			service: "consul_exporter", exporter: "consul_exporter", metricsPath: "/metrics"},
+		{name: "process exporter", port: 9256, body: "<h1>Process Exporter</h1>",
+			service: "process_exporter", exporter: "process_exporter", metricsPath: "/metrics"},
+		{name: "ssl exporter by port", port: 9219, body: "",
+			service: "ssl_exporter", exporter: "ssl_exporter", metricsPath: "/metrics"},
+		{name: "ssl exporter by body", port: 9000, body: "<title>SSL Exporter</title>",
+			service: "ssl_exporter", exporter: "ssl_exporter", metricsPath: "/metrics"},
+		{name: "rabbitmq management", port: 15672, body: "<title>RabbitMQ Management</title>",
+			service: "rabbitmq", exporter: "rabbitmq", metricsPath: "/api/metrics"},
+		{name: "victoriametrics", port: 8428, body: "<h2>Single-node VictoriaMetrics</h2>",
+			service: "victoriametrics", exporter: "victoriametrics", metricsPath: "/metrics"},
+		{name: "home assistant", port: 8123, body: "<title>Home Assistant</title>", service: "home-assistant"},
+		{name: "grafana", port: 3000, body: "<title>Grafana</title>", service: "grafana"},
+		{name: "unknown page", port: 8080, body: "<title>Router</title>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]*httpResponse{"/": testResponse(http.StatusOK, nil, tt.body)}
+			f, evidence := firstMatch(fps, tt.port, responses)
+			if f == nil {
+				if tt.service != "" {
+					t.Errorf("no match, want %s", tt.service)
+				}
+				return
+			}
+			if f.Service != tt.service || f.Exporter != tt.exporter || f.MetricsPath != tt.metricsPath {
+				t.Errorf("match = %s/%s/%s, want %s/%s/%s",
+					f.Service, f.Exporter, f.MetricsPath, tt.service, tt.exporter, tt.metricsPath)
+			}
+			if evidence == "" {
+				t.Error("empty evidence")
+			}
+		})
+	}
+}
+
+func TestFingerprintMatch(t *testing.T) {
+	fps, err := parseFingerprints([]byte(`
+fingerprints:
+  - service: shelly
+    path: shelly
+    status: 200
+    headers: {Content-Type: json}
+    body: '"type":"SH'
+    tags: [smarthome, relay]
+  - service: mikrotik
+    title: (?i)routeros
+  - service: zigbee2mqtt
+    port: [8080, 8081]
+    headers: {Server: ^$}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shelly, mikrotik, z2m := &fps[0], &fps[1], &fps[2]
+	if shelly.Path != "/shelly" || !slices.Equal(shelly.Tags, []string{"smarthome", "relay"}) || shelly.MetricsPath != "" {
+		t.Errorf("shelly rule = %+v", shelly)
+	}
+
+	shellyJSON := `{"type":"SHSW-1","mac":"AABBCCDDEEFF"}`
+	tests := []struct {
+		name     string
+		rule     *Fingerprint
+		port     int
+		resp     *httpResponse
+		evidence string
+	}{
+		{name: "path, status, headers and body", rule: shelly, port: 80,
+			resp:     testResponse(200, map[string]string{"Content-Type": "application/json"}, shellyJSON),
+			evidence: `path /shelly, status 200, header Content-Type ~ "json", body ~ "\"type\":\"SH"`},
+		{name: "wrong status", rule: shelly, port: 80,
+			resp: testResponse(404, map[string]string{"Content-Type": "application/json"}, shellyJSON)},
+		{name: "header mismatch", rule: shelly, port: 80,
+			resp: testResponse(200, map[string]string{"Content-Type": "text/html"}, shellyJSON)},
+		{name: "missing header", rule: shelly, port: 80, resp: testResponse(200, nil, shellyJSON)},
+		{name: "body mismatch", rule: shelly, port: 80,
+			resp: testResponse(200, map[string]string{"Content-Type": "application/json"}, `{"type":"plug"}`)},
+		{name: "title", rule: mikrotik, port: 80,
+			resp:     testResponse(200, nil, "<html><title>RouterOS router configuration page</title></html>"),
+			evidence: `title ~ "(?i)routeros"`},
+		{name: "title mismatch", rule: mikrotik, port: 80, resp: testResponse(200, nil, "<title>Router</title>")},
+		{name: "title is not body", rule: mikrotik, port: 80, resp: testResponse(200, nil, "<p>RouterOS</p>")},
+		{name: "port and empty header", rule: z2m, port: 8081, resp: testResponse(200, nil, ""),
+			evidence: `port 8081, header Server ~ "^$"`},
+		{name: "other port", rule: z2m, port: 80, resp: testResponse(200, nil, "")},
+		{name: "header set", rule: z2m, port: 8080, resp: testResponse(200, map[string]string{"Server": "nginx"}, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evidence, ok := tt.rule.match(tt.port, tt.resp)
+			if ok != (tt.evidence != "") || evidence != tt.evidence {
+				t.Errorf("match = %q, %v, want %q", evidence, ok, tt.evidence)
+			}
+		})
+	}
+}
+
+func TestParseFingerprintsErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, err string
+	}{
+		{name: "no service", yaml: "fingerprints:\n  - body: x\n", err: "service is not set"},
+		{name: "no conditions", yaml: "fingerprints:\n  - service: x\n    path: /x\n", err: "no conditions"},
+		{name: "invalid title", yaml: "fingerprints:\n  - service: x\n    title: '('\n", err: "fingerprint 1 (x)"},
+		{name: "invalid body", yaml: "fingerprints:\n  - service: x\n    body: '['\n", err: "missing closing ]"},
+		{name: "invalid header", yaml: "fingerprints:\n  - service: x\n    headers: {Server: '*'}\n", err: "missing argument"},
+		{name: "invalid yaml", yaml: "fingerprints: {", err: "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFingerprints([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadFingerprints(t *testing.T) {
+	builtin := httpFingerprints
+	t.Cleanup(func() { httpFingerprints = builtin })
+
+	path := writeTestFile(t, "fingerprints.yaml", `
+fingerprints:
+  - service: custom_exporter
+    exporter: custom_exporter
+    body: Node Exporter
+`)
+	if err := LoadFingerprints(path); err != nil {
+		t.Fatal(err)
+	}
+	// rules of file are checked before built-in ones
+	responses := map[string]*httpResponse{"/": testResponse(200, nil, "<h1>Node Exporter</h1>")}
+	if f, _ := firstMatch(httpFingerprints, 9100, responses); f == nil || f.Service != "custom_exporter" {
+		t.Errorf("match = %+v, want custom_exporter", f)
+	}
+	// rules of previous load are replaced
+	for range 2 {
+		if err := LoadFingerprints(path); err != nil {
+			t.Fatal(err)
+		}
+		if len(httpFingerprints) != len(builtin)+1 {
+			t.Errorf("%d rules, want %d", len(httpFingerprints), len(builtin)+1)
+		}
+	}
+
+	if err := LoadFingerprints(writeTestFile(t, "bad.yaml", "fingerprints:\n  - service: x\n")); err == nil {
+		t.Error("LoadFingerprints of invalid rules succeeded")
+	}
+	if err := LoadFingerprints(path + ".missing"); err == nil {
+		t.Error("LoadFingerprints of missing file succeeded")
+	}
+}
+
+func TestHTMLTitle(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{"<html><head><title>Grafana</title></head></html>", "Grafana"},
+		{"<TITLE lang=\"en\">\n  Router\n</TITLE>", "Router"},
+		{"<title></title>", ""},
+		{"no title", ""},
+	}
+	for _, tt := range tests {
+		if got := htmlTitle(tt.body); got != tt.want {
+			t.Errorf("htmlTitle(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package netutils
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// host sources
+const (
+	SourceDNS    = "dns"
+	SourceStatic = "static"
+	SourceDHCP   = "dhcp"
+	SourceMDNS   = "mdns"
+	SourceScan   = "scan"
+)
+
+// Host is a discovered host with the source it came from
+// and attributes forced by static inventory
+type Host struct {
+	Hostname string
+	IP       string
+	Zone     string
+	Source   string
+	MAC      string
+	Liveness string
+	Ping     *PingResult
+
+	Group     string
+	Location  string
+	TCPPorts  []int
+	HTTPPorts []int
+	Meta      map[string]string
+
+	// Ports are open ports found by port scan
+	Ports []ProbeResult
+}
+
+// hostGroups are host name markers of device groups, the last matching marker wins
+var hostGroups = []struct{ marker, group string }{
+	{"light", "light"},
+	{"ipcam", "ipcam"},
+	{"hs", "sockets"},
+	{"mpwr", "sockets"},
+	{"uc", "unicontroller"},
+	{"vacuum", "vacuum"},
+	{"gw", "netdevice"},
+	{"mikrotik", "netdevice"},
+	{"ha", "home-assistant"},
+	{"qnap", "qnap"},
+	{"mqtt", "mqtt-server"},
+	{"printer", "printer"},
+	{"openhab", "openhab"},
+}
+
+// DetectGroup derives device group from host name, empty if no marker matches
+func DetectGroup(hostname string) string {
+	var group string
+	for _, g := range hostGroups {
+		if strings.Contains(hostname, g.marker) {
+			group = g.group
+		}
+	}
+	return group
+}
+
+// Inventory is a set of discovered hosts keyed by ip address
+type Inventory map[string]*Host
+
+// Add puts host into inventory, first host with the same ip wins,
+// only its empty attributes are filled from the later one.
+// Return false if ip is already in inventory
+func (inv Inventory) Add(h Host) bool {
+	if cur, ok := inv[h.IP]; ok {
+		cur.merge(h)
+		return false
+	}
+	inv[h.IP] = &h
+	return true
+}
+
+func (h *Host) merge(o Host) {
+	if h.Hostname == "" {
+		h.Hostname = o.Hostname
+	}
+	if h.Zone == "" {
+		h.Zone = o.Zone
+	}
+	if h.Source == "" {
+		h.Source = o.Source
+	}
+	if h.MAC == "" {
+		h.MAC = o.MAC
+	}
+	if h.Liveness == "" {
+		h.Liveness = o.Liveness
+	}
+	if h.Ping == nil {
+		h.Ping = o.Ping
+	}
+	if h.Group == "" {
+		h.Group = o.Group
+	}
+	if h.Location == "" {
+		h.Location = o.Location
+	}
+	if len(h.Ports) == 0 {
+		h.Ports = o.Ports
+	}
+	h.TCPPorts = AppendPorts(h.TCPPorts, o.TCPPorts...)
+	h.HTTPPorts = AppendPorts(h.HTTPPorts, o.HTTPPorts...)
+	for k, v := range o.Meta {
+		if h.Meta == nil {
+			h.Meta = make(map[string]string, len(o.Meta))
+		}
+		if _, ok := h.Meta[k]; !ok {
+			h.Meta[k] = v
+		}
+	}
+}
+
+// AppendPorts appends ports which are not in list yet
+func AppendPorts(list []int, ports ...int) []int {
+	for _, p := range ports {
+		if !slices.Contains(list, p) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// Merge adds all hosts from other inventory
+func (inv Inventory) Merge(other Inventory) {
+	for _, h := range other {
+		inv.Add(*h)
+	}
+}
+
+// Hosts returns inventory hosts ordered by ip address
+func (inv Inventory) Hosts() []Host {
+	hosts := make([]Host, 0, len(inv))
+	for _, h := range inv {
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := net.ParseIP(hosts[i].IP), net.ParseIP(hosts[j].IP)
+		if a == nil || b == nil {
+			return hosts[i].IP < hosts[j].IP
+		}
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+	return hosts
+}
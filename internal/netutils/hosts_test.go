@@ -0,0 +1,26 @@
+package netutils
+
+import "testing"
+
+func TestDetectGroup(t *testing.T) {
+	tests := map[string]string{
+		"ipcam-01.hm.net":   "ipcam",
+		"light-kitchen":     "light",
+		"mpwr-3.hm.net":     "sockets",
+		"vacuum.hm.net":     "vacuum",
+		"mikrotik.hm.net":   "netdevice",
+		"printer.hm.net":    "printer",
+		"ha.hm.net":         "home-assistant",
+		"mqtt-nkr.hm.net":   "mqtt-server",
+		"nas.example.test":  "",
+		"192.168.2.10":      "",
+		"":                  "",
+		"qnap-gw.hm.net":    "qnap", // the last matching marker wins
+		"openhab-hs.hm.net": "openhab",
+	}
+	for hostname, want := range tests {
+		if got := DetectGroup(hostname); got != want {
+			t.Errorf("DetectGroup(%q) = %q, want %q", hostname, got, want)
+		}
+	}
+}
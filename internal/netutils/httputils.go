@@ -1,112 +1,210 @@
 package netutils
 
 import (
+	"context"
+	"crypto/tls"
 	logger "github.com/sirupsen/logrus"
-	"io/ioutil"
+	"html"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-// check http connection
-// return status: true/false, node_exporter: true/false
-func CheckHTTPConnect(hostname, address string, port int, schema string, ch chan<- map[string]bool) (status bool) {
-	res := make(map[string]bool, 1)
-	if schema != "http" {
-		schema = "https"
+// metaValueLen limits length of meta values, consul allows up to 512 characters
+const metaValueLen = 256
+
+// HTTPInfo is a response of http port root page
+type HTTPInfo struct {
+	Status    int
+	Server    string
+	PoweredBy string
+	Title     string
+	// Location is redirect target
+	Location     string
+	ContentType  string
+	ResponseTime time.Duration
+}
+
+// Meta returns response attributes for service meta, response time is
+// left out as it changes on every scan
+func (i *HTTPInfo) Meta() map[string]string {
+	meta := map[string]string{
+		"http_status":       "",
+		"http_server":       truncate(i.Server, metaValueLen),
+		"http_powered_by":   truncate(i.PoweredBy, metaValueLen),
+		"http_title":        truncate(i.Title, metaValueLen),
+		"http_location":     truncate(i.Location, metaValueLen),
+		"http_content_type": truncate(i.ContentType, metaValueLen),
+	}
+	if i.Status != 0 {
+		meta["http_status"] = strconv.Itoa(i.Status)
 	}
-	url := schema + "://" + address + ":" + strconv.Itoa(port)
-	url_h := schema + "://" + hostname + ":" + strconv.Itoa(port)
-
-	// create http client option
-	client := &http.Client{
-		Timeout: 1 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	return meta
+}
+
+// httpProbeClient is shared by http probes, devices mostly have self-signed certificates.
+// Keep-alives are disabled, so connections to probed ports are not left idle after probe
+var httpProbeClient = &http.Client{
+	Timeout: 1 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+	Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	},
+}
+
+// HTTPProber checks http endpoint, port speaking TLS is checked over https
+// if probe asks for TLS detection. Service is recognized by http detectors
+type HTTPProber struct{}
+
+// Probe implements Prober
+func (HTTPProber) Probe(ctx context.Context, p PortProbe) ProbeResult {
+	res := ProbeResult{PortProbe: p}
+	schema := "http"
+	if p.DetectTLS {
+		if cert, ok := DetectTLS(ctx, p.Hostname, p.IP, p.Port); ok {
+			res.TLS = cert
+			schema = "https"
+		}
 	}
+	url := schema + "://" + p.IP + ":" + strconv.Itoa(p.Port)
+	url_h := schema + "://" + p.Hostname + ":" + strconv.Itoa(p.Port)
+
 	//make get query
-	conn, err := client.Get(url)
+	release, err := probeLimiter.Acquire(ctx, p.IP, 1)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer release()
+	root, err := httpGet(ctx, httpProbeClient, url+"/")
 	if err != nil {
 		logger.WithFields(logger.Fields{
-			"function": "checkHTTPConnect",
+			"function": "HTTPProber.Probe",
 			"address":  url_h,
 		}).Debugln(err)
-
-		res["http_result"] = false
-		ch <- res
-		return false
+		res.Err = err
+		return res
 	}
-	defer conn.Body.Close()
-
-	//check service on this port, may be it some prometheus exporter
-	svc, _ := getServiceName("tcp", port)
-	logger.WithFields(logger.Fields{
-		"function": "checkTCPConnect",
-		"service":  strings.ToUpper(svc),
-	}).Infof("Service %s was found on %s:%d\n", svc, hostname, port)
+	res.Open = true
+	res.Latency = root.elapsed
+	res.HTTP = root.info()
 
-	bytesv, _ := ioutil.ReadAll(conn.Body)
-	httpBody := string(bytesv)
+	//check service on this port by fingerprints, other paths are requested once if rules need them
+	responses := map[string]*httpResponse{"/": root}
+	for i := range httpFingerprints {
+		f := &httpFingerprints[i]
+		if len(f.Port) > 0 && !slices.Contains(f.Port, p.Port) {
+			continue
+		}
+		resp, ok := responses[f.Path]
+		if !ok {
+			resp, _ = httpGet(ctx, httpProbeClient, url+f.Path)
+			responses[f.Path] = resp
+		}
+		if resp == nil {
+			continue
+		}
+		if evidence, ok := f.match(p.Port, resp); ok {
+			logger.WithFields(logger.Fields{"function": "HTTPProber.Probe", "address": url_h}).Infof("Find %s enpoint by %s", f.Service, evidence)
+			res.Service, res.Evidence, res.Exporter, res.Tags = f.Service, evidence, f.Exporter, f.Tags
+			res.MetricsPath = f.MetricsPath
+			if f.Exporter != "" {
+				// version of exporter recognized by landing page
+				if exporter, version, _, ok := scrapeMetrics(ctx, httpProbeClient, url, responses); ok && exporter == f.Exporter {
+					res.Version = version
+				}
+			}
+			return res
+		}
+	}
 
-	//check node exporter, ports 9100,9200
-	if strings.Index(httpBody, "Node Exporter") != -1 {
-		logger.WithFields(logger.Fields{"function": "checkHTTPConnect", "address": url_h}).Info("Find Node Exporter's enpoint")
-		//node_exporter was found in endpoint
-		res["node_exporter"] = true
-		ch <- res
-		return true
-	} else {
-		res["node_exporter"] = false
+	//exporters without landing page are recognized by their metrics
+	if exporter, version, evidence, ok := scrapeMetrics(ctx, httpProbeClient, url, responses); ok {
+		logger.WithFields(logger.Fields{"function": "HTTPProber.Probe", "address": url_h}).Infof("Find %s %s enpoint by %s", exporter, version, evidence)
+		res.Service, res.Evidence, res.Exporter, res.Version = exporter, evidence, exporter, version
+		res.MetricsPath = "/metrics"
+		res.Tags = []string{"prometheus"}
+		return res
 	}
 
-	//check consul_exporter port 9107
-	if strings.Index(httpBody, "Consul Exporter") != -1 {
-		logger.WithFields(logger.Fields{"function": "checkHTTPConnect", "address": url_h}).Info("Find Consul Exporter's enpoint")
-		//consul_exporter was found in endpoint
-		res["consul_exporter"] = true
-		ch <- res
-		return true
-	} else {
-		res["consul_exporter"] = false
+	name, ok := services.Name(ProtoTCP, p.Port)
+	if !ok {
+		logger.WithFields(logger.Fields{"function": "HTTPProber.Probe"}).Infof("Unknown service was found on %s:%d\n", p.Hostname, p.Port)
+		return res
 	}
+	res.Service, res.Evidence = name, EvidencePort
+	logger.WithFields(logger.Fields{
+		"function": "HTTPProber.Probe",
+		"service":  strings.ToUpper(res.Service),
+	}).Infof("Service %s was found on %s:%d\n", res.Service, p.Hostname, p.Port)
+	return res
+}
 
-	//check process_exporter port 9256
-	if strings.Index(httpBody, "Process Exporter") != -1 {
-		logger.WithFields(logger.Fields{"function": "checkHTTPConnect", "address": url_h}).Info("Find Process Exporter's enpoint")
-		//process_exporter was found in endpoint
-		res["process_exporter"] = true
-		ch <- res
-		return true
-	} else {
-		res["process_exporter"] = false
+// scrapeMetrics classifies exporter by /metrics, response is cached in responses
+func scrapeMetrics(ctx context.Context, client *http.Client, url string, responses map[string]*httpResponse) (exporter, version, evidence string, ok bool) {
+	resp, found := responses["/metrics"]
+	if !found {
+		resp, _ = httpGet(ctx, client, url+"/metrics")
+		responses["/metrics"] = resp
 	}
+	if resp == nil || resp.status != http.StatusOK {
+		return "", "", "", false
+	}
+	return ClassifyMetrics(resp.body)
+}
 
-	//check consul_exporter port 9256
-	if port == 15672 {
-		logger.WithFields(logger.Fields{"function": "checkHTTPConnect", "address": url_h}).Info("Find RabbitMQ enpoint")
-		//process_exporter was found in endpoint
-		res["rabbitmq"] = true
-		ch <- res
-		return true
-	} else {
-		res["rabbitmq"] = false
+// httpGet requests url and reads up to 1MiB of body, elapsed is time to response headers
+func httpGet(ctx context.Context, client *http.Client, url string) (*httpResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	conn, err := client.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer conn.Body.Close()
+	elapsed := time.Since(start)
+
+	bytesv, _ := io.ReadAll(io.LimitReader(conn.Body, 1<<20))
+	httpBody := string(bytesv)
+	return &httpResponse{
+		status:  conn.StatusCode,
+		headers: conn.Header,
+		title:   htmlTitle(httpBody),
+		body:    httpBody,
+		elapsed: elapsed,
+	}, nil
+}
 
-	//check vm port 8428
-	if port == 8428 {
-		logger.WithFields(logger.Fields{"function": "checkHTTPConnect", "address": url_h}).Info("Find VictoriaMetrics enpoint")
-		//process_exporter was found in endpoint
-		res["victoriametrics"] = true
-		ch <- res
-		return true
-	} else {
-		res["victoriametrics"] = false
+// info returns response metadata, title is unescaped and its whitespace collapsed
+func (r *httpResponse) info() *HTTPInfo {
+	return &HTTPInfo{
+		Status:       r.status,
+		Server:       r.headers.Get("Server"),
+		PoweredBy:    r.headers.Get("X-Powered-By"),
+		Title:        strings.Join(strings.Fields(html.UnescapeString(r.title)), " "),
+		Location:     r.headers.Get("Location"),
+		ContentType:  r.headers.Get("Content-Type"),
+		ResponseTime: r.elapsed,
 	}
+}
 
-	//if no exporter's service, return http_result => true
-	res["http_result"] = true
-	ch <- res
-	return true
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// do not cut utf-8 sequence
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
 }
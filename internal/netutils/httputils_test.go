@@ -0,0 +1,115 @@
+package netutils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testHTTPProbe(t *testing.T, srv *httptest.Server) PortProbe {
+	t.Helper()
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PortProbe{Hostname: "device.example.test", IP: host, Proto: ProtoHTTP}
+	p.Port, _ = strconv.Atoi(port)
+	return p
+}
+
+func TestHTTPProberInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Server", "lighttpd/1.4")
+		w.Header().Set("Location", "/login")
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusFound)
+		_, _ = w.Write([]byte("<html><head><title>\n  Router &amp; AP\n</title></head></html>"))
+	}))
+	defer srv.Close()
+
+	res := HTTPProber{}.Probe(context.Background(), testHTTPProbe(t, srv))
+	if !res.Open || res.Err != nil || res.HTTP == nil {
+		t.Fatalf("probe = %+v", res)
+	}
+	if res.Latency <= 0 || res.Latency != res.HTTP.ResponseTime {
+		t.Errorf("latency = %v, response time of root page %v", res.Latency, res.HTTP.ResponseTime)
+	}
+	want := HTTPInfo{Status: http.StatusFound, Server: "lighttpd/1.4", Title: "Router & AP", Location: "/login", ContentType: "text/html"}
+	got := *res.HTTP
+	got.ResponseTime = 0
+	if got != want {
+		t.Errorf("http info = %+v, want %+v", got, want)
+	}
+}
+
+func TestHTTPProberConnections(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><title>device</title></html>"))
+	}))
+	var open atomic.Int32
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	p := testHTTPProbe(t, srv)
+
+	for range 5 {
+		if res := (HTTPProber{}).Probe(context.Background(), p); !res.Open {
+			t.Fatalf("probe = %+v", res)
+		}
+	}
+	// probe leaves no idle connections behind
+	deadline := time.Now().Add(2 * time.Second)
+	for open.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("%d connections are open after probes", n)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"longer value", 6, "longer"},
+		{"привет", 3, "п"},
+		{"привет", 4, "пр"},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPInfoMeta(t *testing.T) {
+	meta := (&HTTPInfo{Status: 200, Title: strings.Repeat("т", 200)}).Meta()
+	if meta["http_status"] != "200" || len(meta["http_title"]) != metaValueLen {
+		t.Errorf("meta = %v", meta)
+	}
+	if meta := (&HTTPInfo{}).Meta(); meta["http_status"] != "" {
+		t.Errorf("status of empty info = %q", meta["http_status"])
+	}
+}
@@ -0,0 +1,255 @@
+package netutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reservedMetaKeys are service meta keys set by discovery itself, inventory meta can not override them
+var reservedMetaKeys = []string{
+	"job", "service", "location", "group", "ip", "zone", "liveness", "mac",
+	"service_name", "service_version", "banner", "tags", "metrics_path", "scheme", "version",
+}
+
+// reservedMetaPrefixes are prefixes of discovery meta keys and keys reserved by consul
+var reservedMetaPrefixes = []string{"consul-", "ping_", "tls_", "http_"}
+
+// metaKeyLen is the longest meta key consul accepts
+const metaKeyLen = 128
+
+var invalidMetaKeyRe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+type inventoryEntry struct {
+	Hostname  string            `yaml:"hostname"`
+	IP        string            `yaml:"ip"`
+	Group     string            `yaml:"group"`
+	Location  string            `yaml:"location"`
+	TCPPorts  []int             `yaml:"tcp_ports"`
+	HTTPPorts []int             `yaml:"http_ports"`
+	Meta      map[string]string `yaml:"meta"`
+}
+
+/*
+LoadInventoryFile reads static inventory, format is selected by file extension:
+
+	.yaml/.yml - list of hosts under "hosts" key:
+		hosts:
+		  - hostname: hc.hm.net
+		    ip: 192.168.1.4
+		    group: home-assistant
+		    location: himki
+		    tcp_ports: [1883]
+		    http_ports: [8123]
+		    meta: {owner: admin}
+	.csv - header row with hostname,ip,group,location,tcp_ports,http_ports columns,
+		ports are separated by ';', any other column goes to meta
+	other - hosts file: ip hostname [aliases] [# key=value ...],
+		keys group, location, tcp, http (comma separated ports), others go to meta
+*/
+func LoadInventoryFile(path string) (Inventory, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read inventory file %s, %w", path, err)
+	}
+
+	var entries []inventoryEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = parseInventoryYAML(b)
+	case ".csv":
+		entries, err = parseInventoryCSV(b)
+	default:
+		entries, err = parseInventoryHosts(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse inventory file %s, %w", path, err)
+	}
+
+	inv := make(Inventory, len(entries))
+	for _, e := range entries {
+		if net.ParseIP(e.IP) == nil {
+			return nil, fmt.Errorf("invalid ip %q for host %q in inventory file %s", e.IP, e.Hostname, path)
+		}
+		if e.Hostname == "" {
+			e.Hostname = e.IP
+		}
+		meta, err := sanitizeMeta(e.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("invalid meta for host %q in inventory file %s, %w", e.Hostname, path, err)
+		}
+		inv.Add(Host{
+			Hostname:  e.Hostname,
+			IP:        e.IP,
+			Source:    SourceStatic,
+			Liveness:  LivenessStatic,
+			Group:     e.Group,
+			Location:  e.Location,
+			TCPPorts:  e.TCPPorts,
+			HTTPPorts: e.HTTPPorts,
+			Meta:      meta,
+		})
+	}
+	return inv, nil
+}
+
+func parseInventoryYAML(b []byte) ([]inventoryEntry, error) {
+	var doc struct {
+		Hosts []inventoryEntry `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Hosts, nil
+}
+
+func parseInventoryCSV(b []byte) ([]inventoryEntry, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var entries []inventoryEntry
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e inventoryEntry
+		for i, col := range header {
+			v := strings.TrimSpace(row[i])
+			if err = e.set(col, v, ";"); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseInventoryHosts(b []byte) ([]inventoryEntry, error) {
+	var entries []inventoryEntry
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line, attrs, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		e := inventoryEntry{IP: fields[0]}
+		if len(fields) > 1 {
+			e.Hostname = fields[1]
+		}
+		for _, kv := range strings.Fields(attrs) {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "tcp":
+				k = "tcp_ports"
+			case "http":
+				k = "http_ports"
+			}
+			if err := e.set(k, v, ","); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+func (e *inventoryEntry) set(key, value, portSep string) error {
+	var err error
+	switch key {
+	case "hostname":
+		e.Hostname = value
+	case "ip":
+		e.IP = value
+	case "group":
+		e.Group = value
+	case "location":
+		e.Location = value
+	case "tcp_ports":
+		e.TCPPorts, err = parsePorts(value, portSep)
+	case "http_ports":
+		e.HTTPPorts, err = parsePorts(value, portSep)
+	default:
+		if value == "" {
+			return nil
+		}
+		if e.Meta == nil {
+			e.Meta = make(map[string]string)
+		}
+		e.Meta[key] = value
+	}
+	return err
+}
+
+// sanitizeMeta makes meta keys valid for consul: characters other than letters, digits,
+// '_' and '-' are replaced by '_', keys are cut to 128 and values to 256 characters.
+// Reserved keys are rejected instead of silently overriding discovery attributes
+func sanitizeMeta(meta map[string]string) (map[string]string, error) {
+	if len(meta) == 0 {
+		return nil, nil
+	}
+	res := make(map[string]string, len(meta))
+	for k, v := range meta {
+		key := invalidMetaKeyRe.ReplaceAllString(strings.TrimSpace(k), "_")
+		if len(key) > metaKeyLen {
+			key = key[:metaKeyLen]
+		}
+		lower := strings.ToLower(key)
+		switch {
+		case key == "":
+			return nil, fmt.Errorf("empty meta key")
+		case slices.Contains(reservedMetaKeys, lower):
+			return nil, fmt.Errorf("meta key %q is reserved", k)
+		case slices.ContainsFunc(reservedMetaPrefixes, func(p string) bool { return strings.HasPrefix(lower, p) }):
+			return nil, fmt.Errorf("meta key %q has reserved prefix", k)
+		}
+		if _, ok := res[key]; ok {
+			return nil, fmt.Errorf("meta key %q duplicates %q after sanitizing", k, key)
+		}
+		res[key] = truncate(v, metaValueLen)
+	}
+	return res, nil
+}
+
+func parsePorts(s, sep string) ([]int, error) {
+	var ports []int
+	for _, p := range strings.Split(s, sep) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		ports = append(ports, n)
+	}
+	return ports, nil
+}
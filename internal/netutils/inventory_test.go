@@ -0,0 +1,131 @@
+package netutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInventoryFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []Host
+	}{
+		{name: "yaml", file: "hosts.yaml", content: `
+hosts:
+  - hostname: ha.hm.net
+    ip: 192.168.1.4
+    group: home-assistant
+    location: himki
+    tcp_ports: [1883]
+    http_ports: [8123]
+    meta: {owner: admin}
+  - ip: 192.168.1.5
+`, want: []Host{
+			{Hostname: "ha.hm.net", IP: "192.168.1.4", Group: "home-assistant", Location: "himki",
+				TCPPorts: []int{1883}, HTTPPorts: []int{8123}, Meta: map[string]string{"owner": "admin"}},
+			{Hostname: "192.168.1.5", IP: "192.168.1.5"},
+		}},
+		{name: "csv", file: "hosts.csv", content: `Hostname, IP, group, tcp_ports, http_ports, Owner Name, rack
+# comment
+ha.hm.net, 192.168.1.4, home-assistant, 1883;8883, 8123, admin,
+nas.hm.net, 192.168.1.6, , , , , r1
+`, want: []Host{
+			{Hostname: "ha.hm.net", IP: "192.168.1.4", Group: "home-assistant",
+				TCPPorts: []int{1883, 8883}, HTTPPorts: []int{8123}, Meta: map[string]string{"owner_name": "admin"}},
+			{Hostname: "nas.hm.net", IP: "192.168.1.6", Meta: map[string]string{"rack": "r1"}},
+		}},
+		{name: "hosts", file: "hosts", content: `
+# static hosts
+192.168.1.4  ha.hm.net ha   # group=home-assistant tcp=1883,8883 http=8123 owner=admin
+192.168.1.7
+2001:db8::1  v6.hm.net
+`, want: []Host{
+			{Hostname: "ha.hm.net", IP: "192.168.1.4", Group: "home-assistant",
+				TCPPorts: []int{1883, 8883}, HTTPPorts: []int{8123}, Meta: map[string]string{"owner": "admin"}},
+			{Hostname: "192.168.1.7", IP: "192.168.1.7"},
+			{Hostname: "v6.hm.net", IP: "2001:db8::1"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := LoadInventoryFile(writeTestFile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inv) != len(tt.want) {
+				t.Fatalf("loaded %d hosts, want %d", len(inv), len(tt.want))
+			}
+			for _, want := range tt.want {
+				want.Source, want.Liveness = SourceStatic, LivenessStatic
+				got, ok := inv[want.IP]
+				if !ok {
+					t.Errorf("host %s is missing", want.IP)
+					continue
+				}
+				if !reflect.DeepEqual(*got, want) {
+					t.Errorf("host %s = %+v, want %+v", want.IP, *got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadInventoryFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, err string
+	}{
+		{name: "invalid ip", file: "hosts", content: "192.168.1.300 host\n", err: "invalid ip"},
+		{name: "invalid port", file: "hosts", content: "192.168.1.4 host # tcp=22,ssh\n", err: "invalid port"},
+		{name: "port out of range", file: "hosts.csv", content: "ip,tcp_ports\n192.168.1.4,70000\n", err: "invalid port"},
+		{name: "short csv row", file: "hosts.csv", content: "ip,hostname\n192.168.1.4\n", err: "wrong number of fields"},
+		{name: "reserved meta key", file: "hosts.csv", content: "ip,job\n192.168.1.4,custom\n", err: "reserved"},
+		{name: "reserved meta prefix", file: "hosts", content: "192.168.1.4 host # consul-network-segment=x\n", err: "reserved prefix"},
+		{name: "discovery meta prefix", file: "hosts.yaml", content: "hosts:\n  - ip: 192.168.1.4\n    meta: {tls_subject: x}\n", err: "reserved prefix"},
+		{name: "keys clash after sanitizing", file: "hosts.yaml", content: "hosts:\n  - ip: 192.168.1.4\n    meta: {a.b: x, a b: y}\n", err: "duplicates"},
+		{name: "invalid yaml", file: "hosts.yml", content: "hosts: [", err: "unable to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadInventoryFile(writeTestFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSanitizeMeta(t *testing.T) {
+	long := strings.Repeat("k", 200)
+	got, err := sanitizeMeta(map[string]string{
+		"Owner Name":  "admin",
+		"rack/unit":   "r1",
+		long:          strings.Repeat("v", 600),
+		"serial-no_1": "42",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Owner_Name":             "admin",
+		"rack_unit":              "r1",
+		strings.Repeat("k", 128): strings.Repeat("v", 256),
+		"serial-no_1":            "42",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sanitizeMeta = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,292 @@
+package netutils
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	logger "github.com/sirupsen/logrus"
+)
+
+const mdnsServicesQuery = "_services._dns-sd._udp.local."
+
+// mdnsTXTMetaKeys limits number of TXT keys put to meta of a host, consul accepts 64 meta pairs
+const mdnsTXTMetaKeys = 16
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// MDNSServiceTypes are browsed in addition to types announced via _services._dns-sd._udp
+var MDNSServiceTypes = []string{
+	"_http._tcp",
+	"_https._tcp",
+	"_home-assistant._tcp",
+	"_esphomelib._tcp",
+	"_hap._tcp",
+	"_googlecast._tcp",
+	"_ipp._tcp",
+	"_printer._tcp",
+	"_mqtt._tcp",
+	"_ssh._tcp",
+	"_workstation._tcp",
+	"_miio._udp",
+}
+
+// MDNSService is a service instance announced over DNS-SD
+type MDNSService struct {
+	Instance string
+	Service  string
+	Hostname string
+	IPs      []string
+	Port     int
+	TXT      map[string]string
+}
+
+type srvRecord struct {
+	target string
+	port   int
+}
+
+// mdnsBrowser collects records from responses and asks for missing ones
+type mdnsBrowser struct {
+	conn      *net.UDPConn
+	group     *net.UDPAddr // queries are sent to
+	types     map[string]bool
+	instances map[string]string // instance => service type
+	srv       map[string]srvRecord
+	txt       map[string]map[string]string
+	addrs     map[string][]string
+	asked     map[string]bool
+}
+
+// BrowseMDNS browses DNS-SD service types on local network for timeout and returns found services,
+// browsing is stopped early when ctx is done
+func BrowseMDNS(ctx context.Context, serviceTypes []string, timeout time.Duration) ([]MDNSService, error) {
+	// legacy unicast query, responders answer directly to our port
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open mdns socket, %w", err)
+	}
+	defer conn.Close()
+
+	b := newMDNSBrowser(conn)
+	b.query(mdnsServicesQuery, dns.TypePTR)
+	for _, t := range serviceTypes {
+		b.addType(dns.Fqdn(t + ".local"))
+	}
+
+	buf := make([]byte, 9000)
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	for time.Now().Before(deadline) {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		m := new(dns.Msg)
+		if err = m.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		b.collect(append(m.Answer, m.Extra...))
+	}
+
+	return b.services(), nil
+}
+
+func newMDNSBrowser(conn *net.UDPConn) *mdnsBrowser {
+	return &mdnsBrowser{
+		conn:      conn,
+		group:     mdnsGroup,
+		types:     make(map[string]bool),
+		instances: make(map[string]string),
+		srv:       make(map[string]srvRecord),
+		txt:       make(map[string]map[string]string),
+		addrs:     make(map[string][]string),
+		asked:     make(map[string]bool),
+	}
+}
+
+func (b *mdnsBrowser) query(name string, qtype uint16) {
+	key := dns.TypeToString[qtype] + " " + name
+	if b.asked[key] {
+		return
+	}
+	b.asked[key] = true
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+	p, err := m.Pack()
+	if err != nil {
+		return
+	}
+	if _, err = b.conn.WriteToUDP(p, b.group); err != nil {
+		logger.WithFields(logger.Fields{
+			"function": "mdnsBrowser.query",
+			"query":    key,
+		}).Debugln(err)
+	}
+}
+
+func (b *mdnsBrowser) addType(serviceType string) {
+	if b.types[serviceType] {
+		return
+	}
+	b.types[serviceType] = true
+	b.query(serviceType, dns.TypePTR)
+}
+
+func (b *mdnsBrowser) collect(records []dns.RR) {
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.PTR:
+			if strings.EqualFold(v.Hdr.Name, mdnsServicesQuery) {
+				b.addType(strings.ToLower(v.Ptr))
+				continue
+			}
+			if _, ok := b.instances[v.Ptr]; !ok {
+				b.instances[v.Ptr] = strings.ToLower(v.Hdr.Name)
+			}
+		case *dns.SRV:
+			b.srv[v.Hdr.Name] = srvRecord{target: v.Target, port: int(v.Port)}
+		case *dns.TXT:
+			b.txt[v.Hdr.Name] = parseTXT(v.Txt)
+		case *dns.A:
+			b.addAddr(v.Hdr.Name, v.A.String())
+		case *dns.AAAA:
+			b.addAddr(v.Hdr.Name, v.AAAA.String())
+		}
+	}
+
+	// ask for records responders did not put into additional section
+	for instance := range b.instances {
+		srv, ok := b.srv[instance]
+		if !ok {
+			b.query(instance, dns.TypeSRV)
+			b.query(instance, dns.TypeTXT)
+			continue
+		}
+		if _, ok = b.addrs[srv.target]; !ok {
+			b.query(srv.target, dns.TypeA)
+		}
+	}
+}
+
+func (b *mdnsBrowser) addAddr(name, ip string) {
+	for _, a := range b.addrs[name] {
+		if a == ip {
+			return
+		}
+	}
+	b.addrs[name] = append(b.addrs[name], ip)
+}
+
+func (b *mdnsBrowser) services() []MDNSService {
+	var services []MDNSService
+	for instance, serviceType := range b.instances {
+		srv, ok := b.srv[instance]
+		if !ok {
+			continue
+		}
+		svc := MDNSService{
+			Instance: strings.TrimSuffix(strings.TrimSuffix(instance, "."+serviceType), "."),
+			Service:  strings.TrimSuffix(serviceType, ".local."),
+			Hostname: mdnsHostname(srv.target),
+			IPs:      b.addrs[srv.target],
+			Port:     srv.port,
+			TXT:      b.txt[instance],
+		}
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Hostname != services[j].Hostname {
+			return services[i].Hostname < services[j].Hostname
+		}
+		return services[i].Port < services[j].Port
+	})
+	return services
+}
+
+// mdnsHostname returns host name without .local domain
+func mdnsHostname(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, "."), ".local")
+}
+
+func parseTXT(txt []string) map[string]string {
+	res := make(map[string]string, len(txt))
+	for _, kv := range txt {
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		res[strings.ToLower(k)] = v
+	}
+	return res
+}
+
+// MDNSHosts converts found services to inventory. Ports of _http/_https services
+// become http ports, other tcp services become tcp ports, service types and TXT data
+// (as mdns_txt_<key>) are put to meta. TXT key announced by several services keeps the first value
+func MDNSHosts(services []MDNSService) Inventory {
+	inv := make(Inventory)
+	for _, svc := range services {
+		for _, ip := range svc.IPs {
+			h := Host{
+				Hostname: svc.Hostname,
+				IP:       ip,
+				Source:   SourceMDNS,
+				Meta:     map[string]string{"mdns_services": svc.Service},
+			}
+			switch {
+			case svc.Service == "_http._tcp" || svc.Service == "_https._tcp":
+				h.HTTPPorts = []int{svc.Port}
+			case strings.HasSuffix(svc.Service, "._tcp"):
+				h.TCPPorts = []int{svc.Port}
+			}
+			meta := h.Meta
+			if cur, ok := inv[ip]; ok && cur.Meta["mdns_services"] != "" {
+				meta = cur.Meta
+				if !strings.Contains(","+cur.Meta["mdns_services"]+",", ","+svc.Service+",") {
+					cur.Meta["mdns_services"] += "," + svc.Service
+				}
+			}
+			addTXTMeta(meta, svc.TXT)
+			inv.Add(h)
+		}
+	}
+	return inv
+}
+
+// addTXTMeta puts TXT data to meta with keys valid for consul, existing keys are kept
+func addTXTMeta(meta, txt map[string]string) {
+	n := 0
+	for k := range meta {
+		if strings.HasPrefix(k, "mdns_txt_") {
+			n++
+		}
+	}
+	keys := slices.Sorted(maps.Keys(txt))
+	for _, k := range keys {
+		if n >= mdnsTXTMetaKeys {
+			return
+		}
+		key := truncate("mdns_txt_"+invalidMetaKeyRe.ReplaceAllString(k, "_"), metaKeyLen)
+		if _, ok := meta[key]; ok || txt[k] == "" {
+			continue
+		}
+		meta[key] = truncate(txt[k], metaValueLen)
+		n++
+	}
+}
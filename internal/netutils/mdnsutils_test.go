@@ -0,0 +1,181 @@
+package netutils
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testMDNSResponse is a response of responder with records in answer and additional sections
+func testMDNSResponse(t *testing.T, answer []string, extra ...string) []dns.RR {
+	t.Helper()
+	m := new(dns.Msg)
+	m.Response = true
+	for _, s := range answer {
+		m.Answer = append(m.Answer, testRR(t, s))
+	}
+	for _, s := range extra {
+		m.Extra = append(m.Extra, testRR(t, s))
+	}
+	return append(m.Answer, m.Extra...)
+}
+
+// testMDNSBrowser returns browser sending its queries to loopback socket instead of mdns group
+func testMDNSBrowser(t *testing.T) *mdnsBrowser {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	b := newMDNSBrowser(conn)
+	b.group = conn.LocalAddr().(*net.UDPAddr)
+	return b
+}
+
+func TestMDNSBrowserCollect(t *testing.T) {
+	b := testMDNSBrowser(t)
+	b.addType("_http._tcp.local.")
+
+	// service types announced by responder
+	b.collect(testMDNSResponse(t, []string{
+		`_services._dns-sd._udp.local. 4500 IN PTR _hap._tcp.local.`,
+		`_services._dns-sd._udp.local. 4500 IN PTR _HTTP._tcp.local.`,
+	}))
+	if !b.types["_hap._tcp.local."] || len(b.types) != 2 || !b.asked["PTR _hap._tcp.local."] {
+		t.Errorf("types = %v, asked = %v", b.types, b.asked)
+	}
+
+	// instance with all records in additional section
+	b.collect(testMDNSResponse(t, []string{
+		`_http._tcp.local. 4500 IN PTR shelly1-ABC._http._tcp.local.`,
+	},
+		`shelly1-ABC._http._tcp.local. 120 IN SRV 0 0 80 shelly1-abc.local.`,
+		`shelly1-ABC._http._tcp.local. 4500 IN TXT "gen=1" "App=shelly1" "ver=1.14.0"`,
+		`shelly1-abc.local. 120 IN A 192.168.2.40`,
+		`shelly1-abc.local. 120 IN A 192.168.2.40`,
+	))
+	// instance of responder which sends pointer only, missing records are asked
+	b.collect(testMDNSResponse(t, []string{
+		`_hap._tcp.local. 4500 IN PTR Kitchen\ Light._hap._tcp.local.`,
+	}))
+	for _, q := range []string{`SRV Kitchen\ Light._hap._tcp.local.`, `TXT Kitchen\ Light._hap._tcp.local.`} {
+		if !b.asked[q] {
+			t.Errorf("%s is not asked, asked %v", q, b.asked)
+		}
+	}
+	if got := b.services(); len(got) != 1 || got[0].Hostname != "shelly1-abc" {
+		t.Fatalf("services of incomplete instance = %+v", got)
+	}
+
+	b.collect(testMDNSResponse(t, []string{
+		`Kitchen\ Light._hap._tcp.local. 120 IN SRV 0 0 51827 light-kitchen.local.`,
+		`Kitchen\ Light._hap._tcp.local. 4500 IN TXT "md=Light" "id=AA:BB:CC:DD:EE:FF" "sf=0"`,
+	}))
+	if !b.asked["A light-kitchen.local."] {
+		t.Errorf("address of target is not asked, asked %v", b.asked)
+	}
+	b.collect(testMDNSResponse(t, []string{
+		`light-kitchen.local. 120 IN A 192.168.2.41`,
+		`light-kitchen.local. 120 IN AAAA fe80::1`,
+	}))
+
+	want := []MDNSService{
+		{Instance: `Kitchen\ Light`, Service: "_hap._tcp", Hostname: "light-kitchen", IPs: []string{"192.168.2.41", "fe80::1"}, Port: 51827,
+			TXT: map[string]string{"md": "Light", "id": "AA:BB:CC:DD:EE:FF", "sf": "0"}},
+		{Instance: "shelly1-ABC", Service: "_http._tcp", Hostname: "shelly1-abc", IPs: []string{"192.168.2.40"}, Port: 80,
+			TXT: map[string]string{"gen": "1", "app": "shelly1", "ver": "1.14.0"}},
+	}
+	if got := b.services(); !reflect.DeepEqual(got, want) {
+		t.Errorf("services = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	tests := []struct {
+		txt  []string
+		want map[string]string
+	}{
+		{[]string{"Model=Shelly1", "ver=1.14.0"}, map[string]string{"model": "Shelly1", "ver": "1.14.0"}},
+		// boolean attribute without value, value with '='
+		{[]string{"flag", "url=/api?a=b"}, map[string]string{"flag": "", "url": "/api?a=b"}},
+		{[]string{"", "key="}, map[string]string{"key": ""}},
+		{nil, map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := parseTXT(tt.txt); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTXT(%q) = %v, want %v", tt.txt, got, tt.want)
+		}
+	}
+}
+
+func TestMDNSHostname(t *testing.T) {
+	for name, want := range map[string]string{
+		"shelly1-abc.local.": "shelly1-abc",
+		"shelly1-abc.local":  "shelly1-abc",
+		"nas.hm.net.":        "nas.hm.net",
+		"printer":            "printer",
+	} {
+		if got := mdnsHostname(name); got != want {
+			t.Errorf("mdnsHostname(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestMDNSHosts(t *testing.T) {
+	manyKeys := make(map[string]string)
+	for i := range mdnsTXTMetaKeys + 5 {
+		manyKeys["k"+strconv.Itoa(100+i)] = "v"
+	}
+	services := []MDNSService{
+		{Instance: "ha", Service: "_home-assistant._tcp", Hostname: "homeassistant", IPs: []string{"192.168.2.5"}, Port: 8123,
+			TXT: map[string]string{"version": "2024.5.1", "base_url": "http://192.168.2.5:8123", "flag": ""}},
+		{Instance: "ha", Service: "_http._tcp", Hostname: "homeassistant", IPs: []string{"192.168.2.5"}, Port: 8123,
+			TXT: map[string]string{"version": "other", "path": "/"}},
+		{Instance: "ha", Service: "_http._tcp", Hostname: "homeassistant", IPs: []string{"192.168.2.5"}, Port: 8123},
+		{Instance: "vacuum", Service: "_miio._udp", Hostname: "roborock-vacuum", IPs: []string{"192.168.2.60", "fd00::60"}, Port: 54321,
+			TXT: map[string]string{"epoch": "1", "model id": strings.Repeat("m", 300)}},
+		{Instance: "printer", Service: "_ipp._tcp", Hostname: "printer", IPs: []string{"192.168.2.70"}, Port: 631, TXT: manyKeys},
+	}
+	inv := MDNSHosts(services)
+	if len(inv) != 4 {
+		t.Fatalf("inventory has %d hosts, want 4", len(inv))
+	}
+
+	ha := inv["192.168.2.5"]
+	if ha.Hostname != "homeassistant" || ha.Source != SourceMDNS {
+		t.Errorf("host = %+v", ha)
+	}
+	if !reflect.DeepEqual(ha.TCPPorts, []int{8123}) || !reflect.DeepEqual(ha.HTTPPorts, []int{8123}) {
+		t.Errorf("tcp ports = %v, http ports = %v", ha.TCPPorts, ha.HTTPPorts)
+	}
+	wantMeta := map[string]string{
+		"mdns_services":     "_home-assistant._tcp,_http._tcp",
+		"mdns_txt_version":  "2024.5.1",
+		"mdns_txt_base_url": "http://192.168.2.5:8123",
+		"mdns_txt_path":     "/",
+	}
+	if !reflect.DeepEqual(ha.Meta, wantMeta) {
+		t.Errorf("meta = %v, want %v", ha.Meta, wantMeta)
+	}
+
+	for _, ip := range []string{"192.168.2.60", "fd00::60"} {
+		h := inv[ip]
+		if h == nil || len(h.TCPPorts) != 0 || len(h.HTTPPorts) != 0 {
+			t.Errorf("host of udp service = %+v", h)
+			continue
+		}
+		if h.Meta["mdns_services"] != "_miio._udp" || h.Meta["mdns_txt_epoch"] != "1" || len(h.Meta["mdns_txt_model_id"]) != metaValueLen {
+			t.Errorf("meta = %v", h.Meta)
+		}
+	}
+
+	printer := inv["192.168.2.70"].Meta
+	if len(printer) != mdnsTXTMetaKeys+1 || printer["mdns_txt_k100"] != "v" {
+		t.Errorf("%d meta keys, want %d: %v", len(printer), mdnsTXTMetaKeys+1, printer)
+	}
+}
@@ -0,0 +1,187 @@
+package netutils
+
+import (
+	"bufio"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// genericMetricPrefixes are exposed by client libraries of any exporter
+var genericMetricPrefixes = []string{"go", "process", "promhttp", "python", "jvm", "nodejs", "dotnet", "http", "scrape"}
+
+// metricPrefixExporters maps metric name prefix to exporter name,
+// unknown prefixes are reported as <prefix>_exporter
+var metricPrefixExporters = map[string]string{
+	"node":          "node_exporter",
+	"redis":         "redis_exporter",
+	"mikrotik":      "mikrotik_exporter",
+	"vm":            "victoriametrics",
+	"consul":        "consul_exporter",
+	"namedprocess":  "process_exporter",
+	"ssl":           "ssl_exporter",
+	"rabbitmq":      "rabbitmq",
+	"mysql":         "mysqld_exporter",
+	"pg":            "postgres_exporter",
+	"probe":         "blackbox_exporter",
+	"snmp":          "snmp_exporter",
+	"mongodb":       "mongodb_exporter",
+	"nginx":         "nginx_exporter",
+	"prometheus":    "prometheus",
+	"alertmanager":  "alertmanager",
+	"grafana":       "grafana",
+	"homeassistant": "home-assistant",
+}
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// metricSample is a parsed sample line of text exposition format
+type metricSample struct {
+	name   string
+	labels map[string]string
+}
+
+// ClassifyMetrics recognizes exporter by /metrics response in Prometheus text
+// or OpenMetrics format. *_build_info (and vm_app_version) metrics win, otherwise
+// the most frequent non-generic metric prefix names the exporter.
+// Return false if body is not a metrics exposition
+func ClassifyMetrics(body string) (exporter, version, evidence string, ok bool) {
+	samples := parseMetrics(body)
+	if len(samples) == 0 {
+		return "", "", "", false
+	}
+
+	counts := make(map[string]int)
+	for _, s := range samples {
+		prefix, _, _ := strings.Cut(s.name, "_")
+		if slices.Contains(genericMetricPrefixes, prefix) {
+			continue
+		}
+		if name, found := strings.CutSuffix(s.name, "_build_info"); found {
+			return exporterName(name), s.labels["version"], "metric " + s.name, true
+		}
+		if s.name == "vm_app_version" {
+			return "victoriametrics", vmVersion(s.labels["version"]), "metric " + s.name, true
+		}
+		counts[prefix]++
+	}
+
+	var prefix string
+	for p, n := range counts {
+		if n > counts[prefix] || n == counts[prefix] && p < prefix {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		// client library metrics only
+		return "", "", "", false
+	}
+	return exporterName(prefix), "", "metric prefix " + prefix + "_", true
+}
+
+func exporterName(name string) string {
+	if exp, ok := metricPrefixExporters[name]; ok {
+		return exp
+	}
+	if strings.HasSuffix(name, "_exporter") {
+		return name
+	}
+	return name + "_exporter"
+}
+
+// vmVersion cuts release from victoria-metrics-20240425-...-tags-v1.101.0-0-g...
+func vmVersion(v string) string {
+	if _, tag, ok := strings.Cut(v, "-tags-"); ok {
+		tag, _, _ = strings.Cut(tag, "-")
+		return tag
+	}
+	return v
+}
+
+// parseMetrics returns samples of text exposition, nil if it is not one.
+// Body may be truncated, so a few malformed lines are tolerated
+func parseMetrics(body string) []metricSample {
+	var samples []metricSample
+	var malformed int
+	sc := bufio.NewScanner(strings.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, ok := parseSample(line)
+		if !ok {
+			if malformed++; malformed > len(samples) {
+				return nil
+			}
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// parseSample parses name{label="value",...} value [timestamp] [# exemplar]
+func parseSample(line string) (metricSample, bool) {
+	s := metricSample{labels: make(map[string]string)}
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return s, false
+	}
+	s.name, line = line[:end], line[end:]
+	if !metricNameRe.MatchString(s.name) {
+		return s, false
+	}
+	if strings.HasPrefix(line, "{") {
+		rest, ok := parseLabels(line[1:], s.labels)
+		if !ok {
+			return s, false
+		}
+		line = rest
+	}
+	line, _, _ = strings.Cut(line, "#")
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, false
+	}
+	if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+		return s, false
+	}
+	return s, true
+}
+
+// parseLabels reads labels up to closing brace and returns the rest of line
+func parseLabels(line string, labels map[string]string) (string, bool) {
+	for {
+		line = strings.TrimLeft(line, " ,")
+		if strings.HasPrefix(line, "}") {
+			return line[1:], true
+		}
+		name, rest, ok := strings.Cut(line, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return "", false
+		}
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			value.WriteByte(rest[i])
+		}
+		if i >= len(rest) {
+			return "", false
+		}
+		labels[strings.TrimSpace(name)] = value.String()
+		line = rest[i+1:]
+	}
+}
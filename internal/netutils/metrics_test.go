@@ -0,0 +1,151 @@
+package netutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		exporter string
+		version  string
+		evidence string
+	}{
+		{name: "build info", body: `# HELP node_exporter_build_info A metric with a constant '1' value.
+# TYPE node_exporter_build_info gauge
+node_exporter_build_info{branch="HEAD",goversion="go1.22.1",revision="abc",version="1.8.0"} 1
+go_goroutines 8
+node_load1 0.42
+`, exporter: "node_exporter", version: "1.8.0", evidence: "metric node_exporter_build_info"},
+		{name: "build info of mapped prefix", body: `redis_build_info{version="7.2.4"} 1
+redis_up 1
+`, exporter: "redis_exporter", version: "7.2.4", evidence: "metric redis_build_info"},
+		{name: "build info wins over frequent prefix", body: `process_cpu_seconds_total 1.5
+node_cpu_seconds_total{cpu="0",mode="idle"} 100
+node_cpu_seconds_total{cpu="1",mode="idle"} 100
+prometheus_build_info{version="2.51.0"} 1
+`, exporter: "prometheus", version: "2.51.0", evidence: "metric prometheus_build_info"},
+		{name: "generic build info is skipped", body: `go_build_info{version="go1.22"} 1
+go_gc_duration_seconds{quantile="0"} 0
+mikrotik_interface_rx_bytes{name="ether1"} 1000
+`, exporter: "mikrotik_exporter", evidence: "metric prefix mikrotik_"},
+		{name: "victoriametrics version", body: `vm_app_version{version="victoria-metrics-20240425-173455-tags-v1.101.0-0-g5334f0c4c1",short_version="v1.101.0"} 1
+vm_rows{type="indexdb"} 10
+`, exporter: "victoriametrics", version: "v1.101.0", evidence: "metric vm_app_version"},
+		{name: "most frequent prefix", body: `rabbitmq_queues 3
+rabbitmq_connections 5
+erlang_vm_memory_bytes_total{kind="processes"} 1e+07
+`, exporter: "rabbitmq", evidence: "metric prefix rabbitmq_"},
+		{name: "unknown prefix", body: `shelly_power{channel="0"} 12.5
+shelly_temperature 41
+`, exporter: "shelly_exporter", evidence: "metric prefix shelly_"},
+		{name: "tie is broken by name", body: "beta_up 1\nalpha_up 1\n",
+			exporter: "alpha_exporter", evidence: "metric prefix alpha_"},
+		{name: "openmetrics", body: `# TYPE esphome_sensor gauge
+esphome_sensor_value{id="temp",name="Temperature"} 21.5 1713974400.000
+# EOF
+`, exporter: "esphome_exporter", evidence: "metric prefix esphome_"},
+		{name: "truncated body", body: "consul_up 1\nconsul_raft_leader 1\nconsul_serf_lan_mem",
+			exporter: "consul_exporter", evidence: "metric prefix consul_"},
+		{name: "client library metrics only", body: "go_goroutines 8\nprocess_open_fds 10\npromhttp_metric_handler_requests_total{code=\"200\"} 3\n"},
+		{name: "html page", body: "<html>\n<head><title>Node Exporter</title></head>\n<body>\n<a href=\"/metrics\">Metrics</a>\n</body>\n</html>\n"},
+		{name: "json", body: `{"status":"ok","metrics":[]}`},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, version, evidence, ok := ClassifyMetrics(tt.body)
+			if ok != (tt.exporter != "") {
+				t.Fatalf("ClassifyMetrics = %s, %v, want %s", exporter, ok, tt.exporter)
+			}
+			if exporter != tt.exporter || version != tt.version || evidence != tt.evidence {
+				t.Errorf("ClassifyMetrics = %q, %q, %q, want %q, %q, %q",
+					exporter, version, evidence, tt.exporter, tt.version, tt.evidence)
+			}
+		})
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		labels map[string]string
+		ok     bool
+	}{
+		{line: "up 1", name: "up", labels: map[string]string{}, ok: true},
+		{line: "node_load1\t0.5 1713974400000", name: "node_load1", labels: map[string]string{}, ok: true},
+		{line: `http_requests_total{method="post",code="200"} 1027`, name: "http_requests_total",
+			labels: map[string]string{"method": "post", "code": "200"}, ok: true},
+		{line: `m{a="1", b="2",} +Inf`, name: "m", labels: map[string]string{"a": "1", "b": "2"}, ok: true},
+		{line: `m{path="C:\\dir\"x\"",text="a\nb"} NaN`, name: "m",
+			labels: map[string]string{"path": `C:\dir"x"`, "text": "a\nb"}, ok: true},
+		{line: `m{le="0.5"}1`, name: "m", labels: map[string]string{"le": "0.5"}, ok: true},
+		{line: `requests_total{code="200"} 17 1520879607.789 # {trace_id="KOO5S4vxi0o"} 0.67`, name: "requests_total",
+			labels: map[string]string{"code": "200"}, ok: true},
+		{line: "ns:rule:rate5m 3e-3", name: "ns:rule:rate5m", labels: map[string]string{}, ok: true},
+		{line: "up"},
+		{line: "up one"},
+		{line: "1up 1"},
+		{line: "up 1 2 3"},
+		{line: `m{a=1} 1`},
+		{line: `m{a="1" 1`},
+		{line: `m{a="1"`},
+		{line: "<title>Node Exporter</title>"},
+	}
+	for _, tt := range tests {
+		s, ok := parseSample(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseSample(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if ok && (s.name != tt.name || !reflect.DeepEqual(s.labels, tt.labels)) {
+			t.Errorf("parseSample(%q) = %q %v, want %q %v", tt.line, s.name, s.labels, tt.name, tt.labels)
+		}
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		names []string
+	}{
+		{name: "comments and blank lines", body: "# HELP up x\n\n  up 1\n# TYPE a gauge\na 2\n", names: []string{"up", "a"}},
+		{name: "malformed lines are tolerated", body: "a 1\nb 2\nbroken\nc 3\n", names: []string{"a", "b", "c"}},
+		{name: "more malformed than samples", body: "a 1\nbroken\nagain\nb 2\n"},
+		{name: "malformed first line", body: "<!DOCTYPE html>\na 1\n"},
+		{name: "long line", body: "a{v=\"" + strings.Repeat("x", 100*1024) + "\"} 1\n", names: []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, s := range parseMetrics(tt.body) {
+				names = append(names, s.name)
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("parseMetrics = %q, want %q", names, tt.names)
+			}
+		})
+	}
+}
+
+func TestExporterName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"node", "node_exporter"},
+		{"vm", "victoriametrics"},
+		{"homeassistant", "home-assistant"},
+		{"ups_exporter", "ups_exporter"},
+		{"zigbee", "zigbee_exporter"},
+	}
+	for _, tt := range tests {
+		if got := exporterName(tt.name); got != tt.want {
+			t.Errorf("exporterName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
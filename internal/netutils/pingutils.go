@@ -0,0 +1,212 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+	logger "github.com/sirupsen/logrus"
+)
+
+// PingOptions controls ICMP echo probing
+type PingOptions struct {
+	// Privileged uses raw ICMP sockets (CAP_NET_RAW), otherwise unprivileged
+	// UDP ICMP sockets permitted by net.ipv4.ping_group_range are used
+	Privileged bool
+	Count      int
+	Interval   time.Duration
+	Timeout    time.Duration
+	// TCPFallback treats SYN-ACK or RST on TCPPorts as alive when ICMP is not permitted
+	TCPFallback bool
+	TCPPorts    []int
+}
+
+// DefaultPingOptions returns unprivileged 2 packet ping with tcp fallback
+func DefaultPingOptions() PingOptions {
+	return PingOptions{
+		Count:       2,
+		Interval:    200 * time.Millisecond,
+		Timeout:     1 * time.Second,
+		TCPFallback: true,
+		TCPPorts:    []int{80, 443, 22, 445, 8080},
+	}
+}
+
+// PingResult is a liveness probe result with round trip statistics
+type PingResult struct {
+	IP     string
+	Alive  bool
+	Method string // LivenessICMP or LivenessTCP
+	Sent   int
+	Recv   int
+	Loss   float64 // percent
+	MinRTT time.Duration
+	AvgRTT time.Duration
+	MaxRTT time.Duration
+	Jitter time.Duration // rtt standard deviation
+}
+
+// Meta returns statistics as consul service meta values
+func (r PingResult) Meta() map[string]string {
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	}
+	return map[string]string{
+		"ping_method":     r.Method,
+		"ping_loss":       strconv.FormatFloat(r.Loss, 'f', 1, 64),
+		"ping_rtt_min":    ms(r.MinRTT),
+		"ping_rtt_avg":    ms(r.AvgRTT),
+		"ping_rtt_max":    ms(r.MaxRTT),
+		"ping_rtt_jitter": ms(r.Jitter),
+	}
+}
+
+// PingHost checks host by ICMP echo, host is alive if at least one reply was received.
+// If ICMP socket can not be opened and TCPFallback is set, TCP connect is tried instead.
+// Ping is stopped when ctx is done, replies received so far are counted
+func PingHost(ctx context.Context, address string, opts PingOptions) PingResult {
+	res, err := icmpPinger(ctx, address, opts)
+	if err == nil || ctx.Err() != nil {
+		return res
+	}
+	logger.WithFields(logger.Fields{
+		"function":   "PingHost",
+		"address":    address,
+		"privileged": opts.Privileged,
+	}).Debugln(err)
+
+	if opts.TCPFallback {
+		return TCPPing(ctx, address, opts.TCPPorts, opts.Timeout)
+	}
+	return PingResult{IP: address, Method: LivenessICMP}
+}
+
+// icmpPinger is ICMP echo probe of PingHost, error means ICMP could not be used
+var icmpPinger = icmpPing
+
+func icmpPing(ctx context.Context, address string, opts PingOptions) (PingResult, error) {
+	res := PingResult{IP: address, Method: LivenessICMP}
+	pinger, err := ping.NewPinger(address)
+	if err != nil {
+		return res, err
+	}
+	pinger.SetPrivileged(opts.Privileged)
+	pinger.Count = opts.Count
+	pinger.Interval = opts.Interval
+	pinger.Timeout = opts.Timeout
+	release, err := probeLimiter.Acquire(ctx, address, opts.Count)
+	if err != nil {
+		return res, err
+	}
+	defer release()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			pinger.Stop()
+		case <-done:
+		}
+	}()
+	if err = pinger.Run(); err != nil { // Blocks until finished.
+		return res, err
+	}
+
+	st := pinger.Statistics()
+	res.Alive = st.PacketsRecv > 0
+	res.Sent = st.PacketsSent
+	res.Recv = st.PacketsRecv
+	res.Loss = st.PacketLoss
+	res.MinRTT = st.MinRtt
+	res.AvgRTT = st.AvgRtt
+	res.MaxRTT = st.MaxRtt
+	res.Jitter = st.StdDevRtt
+	return res, nil
+}
+
+// TCPPing treats host as alive if any port answers with SYN-ACK (connected)
+// or RST (connection refused), rtt is the time of the first answer
+func TCPPing(ctx context.Context, address string, ports []int, timeout time.Duration) PingResult {
+	res := PingResult{IP: address, Method: LivenessTCP, Sent: len(ports)}
+	if len(ports) == 0 {
+		return res
+	}
+	answers := make(chan time.Duration, len(ports))
+	for _, port := range ports {
+		go func(port int) {
+			release, err := probeLimiter.Acquire(ctx, address, 1)
+			if err != nil {
+				answers <- -1
+				return
+			}
+			defer release()
+			dialer := &net.Dialer{Timeout: timeout}
+			start := time.Now()
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+			rtt := time.Since(start)
+			if err == nil {
+				conn.Close()
+				answers <- rtt
+				return
+			}
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				answers <- rtt
+				return
+			}
+			answers <- -1
+		}(port)
+	}
+
+	for range ports {
+		if rtt := <-answers; rtt >= 0 {
+			res.Alive = true
+			res.Recv = 1
+			res.MinRTT, res.AvgRTT, res.MaxRTT = rtt, rtt, rtt
+			return res
+		}
+	}
+	res.Loss = 100
+	return res
+}
+
+// PingAlive pings addresses from sequence in no more than threads goroutines
+// and returns results of alive ones. Addresses are taken lazily, so memory does not depend on range size.
+// No new pings are started after ctx is done, results found so far are returned
+func PingAlive(ctx context.Context, addrs iter.Seq[string], threads int, opts PingOptions) []PingResult {
+	tokens := make(chan struct{}, threads)
+	monitoringhostsvc := make(chan PingResult)
+	var wg sync.WaitGroup
+	var monitoringHosts []PingResult
+
+	go func() {
+		for ip := range addrs {
+			if ctx.Err() != nil {
+				break
+			}
+			tokens <- struct{}{}
+			wg.Add(1)
+			go func(ip string, monitoringhostsvc chan<- PingResult) {
+				defer wg.Done()
+				if res := PingHost(ctx, ip, opts); res.Alive {
+					monitoringhostsvc <- res
+				}
+				<-tokens
+			}(ip, monitoringhostsvc)
+		}
+		wg.Wait()
+		close(monitoringhostsvc)
+	}()
+
+	for host := range monitoringhostsvc {
+		monitoringHosts = append(monitoringHosts, host)
+	}
+
+	return monitoringHosts
+}
@@ -0,0 +1,195 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testListener returns port of tcp listener on loopback accepting connections
+func testListener(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns loopback port nothing listens on, connect to it is refused
+func closedPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+// stubICMP replaces ICMP probe of PingHost
+func stubICMP(t *testing.T, f func(ctx context.Context, address string, opts PingOptions) (PingResult, error)) {
+	t.Helper()
+	orig := icmpPinger
+	icmpPinger = f
+	t.Cleanup(func() { icmpPinger = orig })
+}
+
+func TestTCPPing(t *testing.T) {
+	open, closed := testListener(t), closedPort(t)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		ports []int
+		alive bool
+	}{
+		{name: "open port", ctx: context.Background(), ports: []int{open}, alive: true},
+		// RST proves host is up
+		{name: "refused port", ctx: context.Background(), ports: []int{closed}, alive: true},
+		{name: "one of ports", ctx: context.Background(), ports: []int{closed, open}, alive: true},
+		{name: "cancelled", ctx: cancelled, ports: []int{open, closed}},
+		{name: "no ports", ctx: context.Background()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := TCPPing(tt.ctx, "127.0.0.1", tt.ports, time.Second)
+			if res.IP != "127.0.0.1" || res.Method != LivenessTCP || res.Sent != len(tt.ports) || res.Alive != tt.alive {
+				t.Fatalf("result = %+v", res)
+			}
+			if tt.alive {
+				if res.Recv != 1 || res.Loss != 0 || res.MinRTT <= 0 || res.MinRTT != res.AvgRTT || res.MaxRTT != res.AvgRTT {
+					t.Errorf("result of alive host = %+v", res)
+				}
+				return
+			}
+			if res.Recv != 0 || (len(tt.ports) > 0 && res.Loss != 100) {
+				t.Errorf("result of dead host = %+v", res)
+			}
+		})
+	}
+}
+
+func TestPingHostICMP(t *testing.T) {
+	opts := PingOptions{Privileged: true, Count: 2, Interval: 10 * time.Millisecond, Timeout: time.Second}
+	res, err := icmpPing(context.Background(), "127.0.0.1", opts)
+	if err != nil {
+		t.Skipf("icmp is not permitted: %v", err)
+	}
+	if !res.Alive || res.Method != LivenessICMP || res.Sent != 2 || res.Recv != 2 || res.Loss != 0 || res.MinRTT <= 0 || res.MaxRTT < res.MinRTT {
+		t.Errorf("result = %+v", res)
+	}
+	if res = PingHost(context.Background(), "127.0.0.1", opts); !res.Alive || res.Method != LivenessICMP {
+		t.Errorf("PingHost = %+v", res)
+	}
+}
+
+func TestPingHostFallback(t *testing.T) {
+	open := testListener(t)
+	var pinged []string
+	stubICMP(t, func(ctx context.Context, address string, opts PingOptions) (PingResult, error) {
+		pinged = append(pinged, address)
+		return PingResult{IP: address, Method: LivenessICMP}, errors.New("socket: operation not permitted")
+	})
+	opts := PingOptions{Count: 1, Timeout: time.Second, TCPFallback: true, TCPPorts: []int{open}}
+
+	res := PingHost(context.Background(), "127.0.0.1", opts)
+	if !res.Alive || res.Method != LivenessTCP || res.Recv != 1 {
+		t.Errorf("result with fallback = %+v", res)
+	}
+
+	opts.TCPFallback = false
+	res = PingHost(context.Background(), "127.0.0.1", opts)
+	if res.Alive || res.Method != LivenessICMP || res.IP != "127.0.0.1" {
+		t.Errorf("result without fallback = %+v", res)
+	}
+
+	// ICMP interrupted by cancellation is not retried over tcp
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts.TCPFallback = true
+	if res = PingHost(ctx, "127.0.0.1", opts); res.Alive || res.Method != LivenessICMP {
+		t.Errorf("result of cancelled ping = %+v", res)
+	}
+	if len(pinged) != 3 {
+		t.Errorf("icmp is tried %d times, want 3", len(pinged))
+	}
+}
+
+func TestPingHostICMPReply(t *testing.T) {
+	stubICMP(t, func(ctx context.Context, address string, opts PingOptions) (PingResult, error) {
+		return PingResult{IP: address, Method: LivenessICMP, Sent: 2, Recv: 1, Loss: 50}, nil
+	})
+	// ICMP answer is final, even a dead one, tcp is not tried
+	opts := PingOptions{TCPFallback: true, TCPPorts: []int{testListener(t)}}
+	want := PingResult{IP: "127.0.0.1", Method: LivenessICMP, Sent: 2, Recv: 1, Loss: 50}
+	if res := PingHost(context.Background(), "127.0.0.1", opts); res != want {
+		t.Errorf("result = %+v, want %+v", res, want)
+	}
+}
+
+func TestPingAlive(t *testing.T) {
+	stubICMP(t, func(ctx context.Context, address string, opts PingOptions) (PingResult, error) {
+		return PingResult{IP: address, Method: LivenessICMP, Alive: address != "192.168.2.2"}, nil
+	})
+	addrs := slices.Values([]string{"192.168.2.1", "192.168.2.2", "192.168.2.3"})
+	var alive []string
+	for _, res := range PingAlive(context.Background(), addrs, 2, DefaultPingOptions()) {
+		alive = append(alive, res.IP)
+	}
+	slices.Sort(alive)
+	if !slices.Equal(alive, []string{"192.168.2.1", "192.168.2.3"}) {
+		t.Errorf("alive = %v", alive)
+	}
+}
+
+func TestPingResultMeta(t *testing.T) {
+	res := PingResult{
+		Method: LivenessICMP,
+		Loss:   100.0 / 3,
+		MinRTT: 1500 * time.Microsecond,
+		AvgRTT: 2*time.Millisecond + 123456*time.Nanosecond,
+		MaxRTT: 3 * time.Millisecond,
+		Jitter: 600 * time.Nanosecond,
+	}
+	want := map[string]string{
+		"ping_method":     "icmp",
+		"ping_loss":       "33.3",
+		"ping_rtt_min":    "1.500",
+		"ping_rtt_avg":    "2.123",
+		"ping_rtt_max":    "3.000",
+		"ping_rtt_jitter": "0.001",
+	}
+	if got := res.Meta(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Meta = %v, want %v", got, want)
+	}
+
+	want = map[string]string{
+		"ping_method":     "tcp",
+		"ping_loss":       "100.0",
+		"ping_rtt_min":    "0.000",
+		"ping_rtt_avg":    "0.000",
+		"ping_rtt_max":    "0.000",
+		"ping_rtt_jitter": "0.000",
+	}
+	if got := (PingResult{Method: LivenessTCP, Loss: 100}).Meta(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Meta of dead host = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package netutils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// probe protocols
+const (
+	ProtoTCP  = "tcp"
+	ProtoHTTP = "http"
+	ProtoUDP  = "udp"
+)
+
+// evidence of services detected without protocol specific check
+const (
+	EvidencePort   = "port"
+	EvidenceBanner = "banner"
+)
+
+// PortProbe is a single port check of a host
+type PortProbe struct {
+	Hostname string
+	IP       string
+	Port     int
+	Proto    string
+	// GrabBanner identifies service on open tcp port by its banner
+	GrabBanner bool
+	// DetectTLS tries TLS handshake on open port, http is checked over https on TLS ports
+	DetectTLS bool
+}
+
+// ProbeResult is a result of a port check
+type ProbeResult struct {
+	PortProbe
+	Open bool
+	// Latency is time of tcp connect, of response to http root request or to udp request
+	Latency time.Duration
+	// Service is detected service name, empty if nothing was detected
+	Service string
+	// Evidence tells how service was detected: banner, page marker or port number
+	Evidence string
+	// Exporter is exporter type when service is a prometheus exporter
+	Exporter string
+	// Version is exporter version reported by its metrics
+	Version string
+	// MetricsPath is metrics endpoint of exporter
+	MetricsPath string
+	Tags        []string
+	// Banner is service greeting or response to hello probe
+	Banner string
+	TLS    *Certificate
+	// HTTP is response of root page of http port
+	HTTP *HTTPInfo
+	Err  error
+}
+
+// Prober checks a port with one protocol, it measures latency of open port itself
+// so that waiting for rate limiter and service detection are not counted
+type Prober interface {
+	Probe(ctx context.Context, p PortProbe) ProbeResult
+}
+
+// probers are used by ScanPorts by probe protocol
+var probers = map[string]Prober{
+	ProtoTCP:  TCPProber{},
+	ProtoHTTP: HTTPProber{},
+	ProtoUDP:  UDPProber{},
+}
+
+// RegisterProber sets prober of protocol, existing one is replaced
+func RegisterProber(proto string, p Prober) {
+	probers[proto] = p
+}
+
+// ScanPorts runs probes in a pool of threads workers, results are returned
+// in the order of probes. Probes not started before ctx is done are skipped
+func ScanPorts(ctx context.Context, probes []PortProbe, threads int) []ProbeResult {
+	if threads < 1 {
+		threads = 1
+	}
+	results := make([]ProbeResult, len(probes))
+	done := make([]bool, len(probes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				p := probes[idx]
+				prober, ok := probers[p.Proto]
+				if !ok {
+					results[idx] = ProbeResult{PortProbe: p, Err: fmt.Errorf("no prober for protocol %s", p.Proto)}
+				} else {
+					results[idx] = prober.Probe(ctx, p)
+				}
+				done[idx] = true
+				logger.WithFields(logger.Fields{
+					"function": "ScanPorts",
+					"address":  p.Hostname,
+					"port":     p.Port,
+					"proto":    p.Proto,
+				}).Debugf("Probe latency: %v, open: %v, error: %v", results[idx].Latency, results[idx].Open, results[idx].Err)
+			}
+		}()
+	}
+
+	for idx := range probes {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	// drop probes skipped after cancellation
+	finished := results[:0]
+	for idx, r := range results {
+		if done[idx] {
+			finished = append(finished, r)
+		}
+	}
+	return finished
+}
+
+// TLSEndpoints returns endpoints of results which presented certificate,
+// port probed as both tcp and http is returned once
+func TLSEndpoints(results []ProbeResult) []TLSEndpoint {
+	var endpoints []TLSEndpoint
+	seen := make(map[string]bool)
+	for _, r := range results {
+		key := net.JoinHostPort(r.IP, strconv.Itoa(r.Port))
+		if r.TLS != nil && !seen[key] {
+			seen[key] = true
+			endpoints = append(endpoints, TLSEndpoint{Hostname: r.Hostname, IP: r.IP, Port: r.Port, Cert: r.TLS})
+		}
+	}
+	return endpoints
+}
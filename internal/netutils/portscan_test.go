@@ -0,0 +1,113 @@
+package netutils
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// proberFunc is a Prober of a function
+type proberFunc func(ctx context.Context, p PortProbe) ProbeResult
+
+func (f proberFunc) Probe(ctx context.Context, p PortProbe) ProbeResult {
+	return f(ctx, p)
+}
+
+func testProber(t *testing.T, proto string, f proberFunc) {
+	t.Helper()
+	RegisterProber(proto, f)
+	t.Cleanup(func() { delete(probers, proto) })
+}
+
+func TestScanPortsOrder(t *testing.T) {
+	// earlier probes take longer, so they finish last
+	testProber(t, "test", func(ctx context.Context, p PortProbe) ProbeResult {
+		time.Sleep(time.Duration(20-p.Port) * time.Millisecond)
+		return ProbeResult{PortProbe: p, Open: p.Port%2 == 0}
+	})
+	var probes []PortProbe
+	for port := range 20 {
+		probes = append(probes, PortProbe{IP: "192.168.2.10", Port: port, Proto: "test"})
+	}
+	probes = append(probes, PortProbe{IP: "192.168.2.10", Port: 20, Proto: "unknown"})
+
+	results := ScanPorts(context.Background(), probes, 4)
+	if len(results) != len(probes) {
+		t.Fatalf("%d results, want %d", len(results), len(probes))
+	}
+	for i, r := range results[:20] {
+		if r.Port != i || r.Proto != "test" || r.Open != (i%2 == 0) || r.Err != nil {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+	if r := results[20]; r.Port != 20 || r.Open || r.Err == nil {
+		t.Errorf("result of probe without prober = %+v", r)
+	}
+}
+
+func TestScanPortsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var started atomic.Int32
+	testProber(t, "test", func(ctx context.Context, p PortProbe) ProbeResult {
+		if started.Add(1) == 5 {
+			cancel()
+		}
+		// probe in progress sees cancellation
+		select {
+		case <-ctx.Done():
+			return ProbeResult{PortProbe: p, Err: ctx.Err()}
+		case <-time.After(10 * time.Millisecond):
+			return ProbeResult{PortProbe: p, Open: true}
+		}
+	})
+	var probes []PortProbe
+	for port := range 100 {
+		probes = append(probes, PortProbe{IP: "192.168.2.10", Port: port, Proto: "test"})
+	}
+
+	start := time.Now()
+	results := ScanPorts(ctx, probes, 2)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled scan took %v", elapsed)
+	}
+	// probes started before cancellation are returned in order, the rest are skipped
+	if n := int(started.Load()); len(results) != n || n >= len(probes) {
+		t.Fatalf("%d results of %d started probes", len(results), n)
+	}
+	for i, r := range results {
+		if r.Port != i {
+			t.Errorf("result %d is of port %d", i, r.Port)
+		}
+	}
+	if last := results[len(results)-1]; last.Err == nil {
+		t.Errorf("probe running at cancellation = %+v", last)
+	}
+}
+
+func TestScanPortsLatency(t *testing.T) {
+	// time spent by prober out of port check is not latency
+	testProber(t, "test", func(ctx context.Context, p PortProbe) ProbeResult {
+		time.Sleep(20 * time.Millisecond)
+		return ProbeResult{PortProbe: p, Open: true, Latency: time.Millisecond}
+	})
+	results := ScanPorts(context.Background(), []PortProbe{{IP: "192.168.2.10", Port: 80, Proto: "test"}}, 1)
+	if len(results) != 1 || results[0].Latency != time.Millisecond {
+		t.Errorf("results = %+v, want latency of prober", results)
+	}
+}
+
+func TestTCPProberLatency(t *testing.T) {
+	p := PortProbe{Hostname: "localhost", IP: "127.0.0.1", Port: testListener(t), Proto: ProtoTCP}
+	res := TCPProber{}.Probe(context.Background(), p)
+	if !res.Open || res.Latency <= 0 || res.Latency > time.Second {
+		t.Errorf("probe of open port = %+v", res)
+	}
+
+	p.Port = closedPort(t)
+	res = TCPProber{}.Probe(context.Background(), p)
+	if res.Open || res.Err == nil || res.Latency != 0 {
+		t.Errorf("probe of closed port = %+v", res)
+	}
+}
@@ -0,0 +1,270 @@
+package netutils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scan profile names
+const (
+	ProfileQuick  = "quick"
+	ProfileIoT    = "iot"
+	ProfileFull   = "full"
+	ProfileCustom = "custom"
+)
+
+// topTCPPorts are the most frequently open tcp ports, most common first
+var topTCPPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139,
+	143, 53, 135, 3306, 8080, 1723, 111, 995, 993, 5900,
+	1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001,
+	10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554,
+	26, 1433, 49152, 2001, 515, 8008, 49154, 1027, 5666, 646,
+	5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106,
+	2121, 1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543,
+	544, 5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009,
+	7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051,
+	6646, 49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37,
+}
+
+// ScanProfile is a set of ports probed on a host
+type ScanProfile struct {
+	Name      string
+	TCPPorts  []int
+	HTTPPorts []int
+	UDPPorts  []int
+}
+
+// ScanProfiles selects scan profile by host group
+type ScanProfiles struct {
+	Profiles map[string]ScanProfile
+	Default  string
+	// Groups maps host group to profile name
+	Groups map[string]string
+	// GrabBanners identifies services on open tcp ports by banners
+	GrabBanners bool
+	// DetectTLS tries TLS handshake on open tcp and http ports
+	DetectTLS bool
+}
+
+type scanProfilesFile struct {
+	Default  string `yaml:"default"`
+	Profiles map[string]struct {
+		TCP  []string `yaml:"tcp"`
+		HTTP []string `yaml:"http"`
+		UDP  []string `yaml:"udp"`
+	} `yaml:"profiles"`
+	Groups map[string]string `yaml:"groups"`
+}
+
+// NewScanProfiles returns built-in profiles with quick profile as default
+func NewScanProfiles() *ScanProfiles {
+	p := &ScanProfiles{
+		Profiles: make(map[string]ScanProfile),
+		Default:  ProfileQuick,
+		Groups:   make(map[string]string),
+	}
+	for name, spec := range map[string][3]string{
+		// servers with exporters
+		ProfileQuick: {"21,22,1883,3306,5432,6379", "80,443,9100,9200,8123,3000,9219,9256,9107,8428", "53,161"},
+		// cameras, sockets, hubs and other smart home devices
+		ProfileIoT: {"22,23,554,1883,6668,8554,8883,9999", "80,81,443,8080,8081,8443,8123,6052", "161,5353,5683,54321"},
+		ProfileFull: {"1-1024,top100,1883,3306,5432,6379,8883,27017",
+			"80,81,443,3000,8000-8100,8123,8428,8443,9090-9110,9219,9256", "53,161,5353,5683,54321"},
+	} {
+		_ = p.Set(name, []string{spec[0]}, []string{spec[1]}, []string{spec[2]})
+	}
+	return p
+}
+
+// Set defines profile from port specs, see ParsePortSpecs
+func (p *ScanProfiles) Set(name string, tcp, http, udp []string) error {
+	tcpPorts, err := ParsePortSpecs(tcp, ProtoTCP)
+	if err != nil {
+		return fmt.Errorf("invalid tcp ports of profile %s, %w", name, err)
+	}
+	httpPorts, err := ParsePortSpecs(http, ProtoTCP)
+	if err != nil {
+		return fmt.Errorf("invalid http ports of profile %s, %w", name, err)
+	}
+	udpPorts, err := ParsePortSpecs(udp, ProtoUDP)
+	if err != nil {
+		return fmt.Errorf("invalid udp ports of profile %s, %w", name, err)
+	}
+	for _, port := range udpPorts {
+		if _, ok := udpServices[port]; !ok {
+			return fmt.Errorf("no probe payload for udp port %d of profile %s, known ports %v", port, name, UDPPorts())
+		}
+	}
+	p.Profiles[name] = ScanProfile{Name: name, TCPPorts: tcpPorts, HTTPPorts: httpPorts, UDPPorts: udpPorts}
+	return nil
+}
+
+/*
+LoadFile reads profiles from yaml file, profiles with built-in names override them:
+
+	default: quick
+	profiles:
+	  custom:
+	    tcp: [ssh, 8000-8100, top20]
+	    http: [80, 8080]
+	    udp: [161, 5683]
+	groups:
+	  ipcam: iot
+*/
+func (p *ScanProfiles) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read scan profiles file %s, %w", path, err)
+	}
+	var f scanProfilesFile
+	if err = yaml.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("unable to parse scan profiles file %s, %w", path, err)
+	}
+	for name, prof := range f.Profiles {
+		if err = p.Set(name, prof.TCP, prof.HTTP, prof.UDP); err != nil {
+			return fmt.Errorf("%w in scan profiles file %s", err, path)
+		}
+	}
+	if f.Default != "" {
+		p.Default = f.Default
+	}
+	for group, name := range f.Groups {
+		p.Groups[group] = name
+	}
+	return nil
+}
+
+// SetGroups assigns profiles to host groups from specs like "ipcam:iot", that is group:profile
+func (p *ScanProfiles) SetGroups(specs []string) error {
+	for _, spec := range specs {
+		group, name, ok := strings.Cut(spec, ":")
+		if !ok || group == "" || name == "" {
+			return fmt.Errorf("invalid group profile %q, expected group:profile", spec)
+		}
+		p.Groups[group] = name
+	}
+	return nil
+}
+
+// Validate checks that default and group profiles are defined
+func (p *ScanProfiles) Validate() error {
+	if _, ok := p.Profiles[p.Default]; !ok {
+		return fmt.Errorf("unknown scan profile %q", p.Default)
+	}
+	for group, name := range p.Groups {
+		if _, ok := p.Profiles[name]; !ok {
+			return fmt.Errorf("unknown scan profile %q for group %s", name, group)
+		}
+	}
+	return nil
+}
+
+// ForGroup returns profile of host group, default profile if group has none
+func (p *ScanProfiles) ForGroup(group string) ScanProfile {
+	if name, ok := p.Groups[group]; ok {
+		if prof, found := p.Profiles[name]; found {
+			return prof
+		}
+	}
+	return p.Profiles[p.Default]
+}
+
+// Probes returns port probes of host for profile of its group,
+// ports forced by inventory are probed in addition
+func (p *ScanProfiles) Probes(hostname string, host Host) []PortProbe {
+	prof := p.ForGroup(host.Group)
+	var probes []PortProbe
+	for _, port := range AppendPorts(append([]int(nil), prof.TCPPorts...), host.TCPPorts...) {
+		probes = append(probes, PortProbe{Hostname: hostname, IP: host.IP, Port: port, Proto: ProtoTCP,
+			GrabBanner: p.GrabBanners, DetectTLS: p.DetectTLS})
+	}
+	for _, port := range AppendPorts(append([]int(nil), prof.HTTPPorts...), host.HTTPPorts...) {
+		probes = append(probes, PortProbe{Hostname: hostname, IP: host.IP, Port: port, Proto: ProtoHTTP, DetectTLS: p.DetectTLS})
+	}
+	for _, port := range prof.UDPPorts {
+		probes = append(probes, PortProbe{Hostname: hostname, IP: host.IP, Port: port, Proto: ProtoUDP})
+	}
+	return probes
+}
+
+// ParsePortSpecs parses comma separated ports, ranges like 8000-8100, top lists
+// like top20 and service names like ssh known for proto. Numbers are tried before
+// names, so names starting with digit like 9pfs work. Duplicates are dropped, order is kept
+func ParsePortSpecs(specs []string, proto string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	add := func(port int) {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	for _, spec := range specs {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if n, ok := strings.CutPrefix(item, "top"); ok {
+				if top, err := strconv.Atoi(n); err == nil {
+					if top < 1 {
+						return nil, fmt.Errorf("invalid top ports %q", item)
+					}
+					for _, port := range topTCPPorts[:min(top, len(topTCPPorts))] {
+						add(port)
+					}
+					continue
+				}
+			}
+			first, last, err := parsePortRange(item)
+			if err == nil {
+				for port := first; port <= last; port++ {
+					add(port)
+				}
+				continue
+			}
+			named := services.Ports(item, proto)
+			if len(named) == 0 {
+				if item[0] >= '0' && item[0] <= '9' {
+					return nil, err
+				}
+				return nil, fmt.Errorf("unknown %s service %q", proto, item)
+			}
+			for _, port := range named {
+				add(port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// parsePortRange parses port or range of ports like 8000-8100
+func parsePortRange(item string) (first, last int, err error) {
+	from, to, isRange := strings.Cut(item, "-")
+	if first, err = parsePort(from); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	if last, err = parsePort(to); err != nil {
+		return 0, 0, err
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("invalid port range %q", item)
+	}
+	return first, last, nil
+}
+
+func parsePort(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,168 @@
+package netutils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePortSpecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		proto string
+		want  []int
+	}{
+		{name: "list", specs: []string{"22,80, 443"}, proto: ProtoTCP, want: []int{22, 80, 443}},
+		{name: "several specs", specs: []string{"22", "80,8080"}, proto: ProtoTCP, want: []int{22, 80, 8080}},
+		{name: "range", specs: []string{"8000-8003"}, proto: ProtoTCP, want: []int{8000, 8001, 8002, 8003}},
+		{name: "top list", specs: []string{"top5"}, proto: ProtoTCP, want: []int{80, 23, 443, 21, 22}},
+		{name: "top list longer than known", specs: []string{"top1000"}, proto: ProtoTCP, want: topTCPPorts},
+		{name: "duplicates keep first position", specs: []string{"443,80-81,top1,443"}, proto: ProtoTCP, want: []int{443, 80, 81}},
+		{name: "empty items", specs: []string{"", ",22,,"}, proto: ProtoTCP, want: []int{22}},
+		{name: "service names", specs: []string{"ssh,HTTP,mqtt"}, proto: ProtoTCP, want: []int{22, 80, 1883}},
+		{name: "service alias", specs: []string{"www,postgres"}, proto: ProtoTCP, want: []int{80, 5432}},
+		{name: "udp service names", specs: []string{"domain,snmp,miio"}, proto: ProtoUDP, want: []int{53, 161, 54321}},
+		{name: "no specs", proto: ProtoTCP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePortSpecs(tt.specs, tt.proto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParsePortSpecs(%q) = %v, want %v", tt.specs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePortSpecsErrors(t *testing.T) {
+	tests := []struct {
+		spec  string
+		proto string
+	}{
+		{"0", ProtoTCP},
+		{"65536", ProtoTCP},
+		{"-1", ProtoTCP},
+		{"100-90", ProtoTCP},
+		{"10-x", ProtoTCP},
+		{"top0", ProtoTCP},
+		{"topx", ProtoTCP},
+		{"no-such-service", ProtoTCP},
+		{"ssh", ProtoUDP},
+	}
+	for _, tt := range tests {
+		if ports, err := ParsePortSpecs([]string{tt.spec}, tt.proto); err == nil {
+			t.Errorf("ParsePortSpecs(%q, %s) = %v, want error", tt.spec, tt.proto, ports)
+		}
+	}
+}
+
+func TestScanProfilesGroups(t *testing.T) {
+	p := NewScanProfiles()
+	if err := p.SetGroups([]string{"ipcam:iot", "nas:full"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group, want string
+	}{
+		{"ipcam", ProfileIoT},
+		{"nas", ProfileFull},
+		{"", ProfileQuick},
+		{"printer", ProfileQuick},
+	}
+	for _, tt := range tests {
+		if got := p.ForGroup(tt.group).Name; got != tt.want {
+			t.Errorf("ForGroup(%q) = %s, want %s", tt.group, got, tt.want)
+		}
+	}
+
+	p.Groups["light"] = "missing"
+	if err := p.Validate(); err == nil {
+		t.Error("Validate succeeded with unknown group profile")
+	}
+	for _, spec := range []string{"ipcam", "ipcam:", ":iot"} {
+		if err := p.SetGroups([]string{spec}); err == nil {
+			t.Errorf("SetGroups(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestScanProfilesProbes(t *testing.T) {
+	p := NewScanProfiles()
+	p.GrabBanners, p.DetectTLS = true, true
+	if err := p.SetGroups([]string{"ipcam:iot"}); err != nil {
+		t.Fatal(err)
+	}
+	host := Host{IP: "192.168.2.50", Group: "ipcam", TCPPorts: []int{554, 10554}, HTTPPorts: []int{8899}}
+
+	ports := make(map[string][]int)
+	for _, probe := range p.Probes("ipcam-01", host) {
+		if probe.Hostname != "ipcam-01" || probe.IP != host.IP {
+			t.Errorf("probe %+v is not for host", probe)
+		}
+		if probe.GrabBanner != (probe.Proto == ProtoTCP) || probe.DetectTLS == (probe.Proto == ProtoUDP) {
+			t.Errorf("probe %+v has wrong options", probe)
+		}
+		ports[probe.Proto] = append(ports[probe.Proto], probe.Port)
+	}
+	iot := p.Profiles[ProfileIoT]
+	// inventory ports are probed in addition to profile ones, once
+	if want := append(slices.Clone(iot.TCPPorts), 10554); !slices.Equal(ports[ProtoTCP], want) {
+		t.Errorf("tcp probes = %v, want %v", ports[ProtoTCP], want)
+	}
+	if want := append(slices.Clone(iot.HTTPPorts), 8899); !slices.Equal(ports[ProtoHTTP], want) {
+		t.Errorf("http probes = %v, want %v", ports[ProtoHTTP], want)
+	}
+	if !slices.Equal(ports[ProtoUDP], iot.UDPPorts) {
+		t.Errorf("udp probes = %v, want %v", ports[ProtoUDP], iot.UDPPorts)
+	}
+	if !slices.Contains(ports[ProtoTCP], 554) || !slices.Contains(ports[ProtoHTTP], 80) {
+		t.Errorf("camera is not probed on 554/tcp and 80/http: %v", ports)
+	}
+}
+
+func TestScanProfilesLoadFile(t *testing.T) {
+	path := writeTestFile(t, "profiles.yaml", `
+default: nas
+profiles:
+  nas:
+    tcp: [22, 445, 5000-5001]
+    http: [top2]
+    udp: [161]
+  quick:
+    tcp: [22]
+groups:
+  storage: nas
+`)
+	p := NewScanProfiles()
+	if err := p.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	nas := p.ForGroup("other")
+	if nas.Name != "nas" || !slices.Equal(nas.TCPPorts, []int{22, 445, 5000, 5001}) ||
+		!slices.Equal(nas.HTTPPorts, []int{80, 23}) || !slices.Equal(nas.UDPPorts, []int{161}) {
+		t.Errorf("default profile = %+v", nas)
+	}
+	if p.Groups["storage"] != "nas" {
+		t.Errorf("groups = %v", p.Groups)
+	}
+	// built-in profile is overridden
+	if quick := p.Profiles[ProfileQuick]; !slices.Equal(quick.TCPPorts, []int{22}) || len(quick.HTTPPorts) != 0 {
+		t.Errorf("quick profile = %+v", quick)
+	}
+
+	bad := writeTestFile(t, "bad.yaml", "profiles:\n  cams:\n    udp: [9999]\n")
+	if err := NewScanProfiles().LoadFile(bad); err == nil || !strings.Contains(err.Error(), "no probe payload") {
+		t.Errorf("LoadFile error = %v, want missing udp payload", err)
+	}
+}
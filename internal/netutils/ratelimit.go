@@ -0,0 +1,172 @@
+package netutils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// GroupLimit overrides rate limits for hosts of a group, zero values mean global limits
+type GroupLimit struct {
+	PPS     int
+	PerHost int
+}
+
+// RateLimiter is shared by ping, TCP and HTTP probes. It caps packets per second
+// globally and per group, and number of concurrent probes per host
+type RateLimiter struct {
+	global  *rate.Limiter
+	perHost int
+	groups  map[string]GroupLimit
+
+	mu            sync.Mutex
+	groupLimiters map[string]*rate.Limiter
+	hostGroups    map[string]string
+	// slots are keyed by group too, so group cap applies once host group is known
+	hostSlots map[hostGroup]chan struct{}
+}
+
+// hostGroup is a host address in a group
+type hostGroup struct {
+	address string
+	group   string
+}
+
+// probeLimiter is used by all probes, nil means unlimited
+var probeLimiter *RateLimiter
+
+// SetRateLimiter sets limiter for all probes, nil disables limiting
+func SetRateLimiter(l *RateLimiter) {
+	probeLimiter = l
+}
+
+/*
+pps - global packets per second, unlimited if 0
+perHost - concurrent probes per host, unlimited if 0
+groups - per group overrides
+*/
+func NewRateLimiter(pps, perHost int, groups map[string]GroupLimit) *RateLimiter {
+	l := &RateLimiter{
+		perHost:       perHost,
+		groups:        groups,
+		groupLimiters: make(map[string]*rate.Limiter),
+		hostGroups:    make(map[string]string),
+		hostSlots:     make(map[hostGroup]chan struct{}),
+	}
+	if pps > 0 {
+		l.global = rate.NewLimiter(rate.Limit(pps), 1)
+	}
+	for name, g := range groups {
+		if g.PPS > 0 {
+			l.groupLimiters[name] = rate.NewLimiter(rate.Limit(g.PPS), 1)
+		}
+	}
+	return l
+}
+
+// SetHostGroup assigns host address to group for per group overrides
+func (l *RateLimiter) SetHostGroup(address, group string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.hostGroups[address] = group
+	l.mu.Unlock()
+}
+
+// Acquire waits for a probe slot on host and for packets budget,
+// release must be called when probe is finished. Error is returned if ctx is done
+func (l *RateLimiter) Acquire(ctx context.Context, address string, packets int) (release func(), err error) {
+	if l == nil {
+		return func() {}, ctx.Err()
+	}
+
+	l.mu.Lock()
+	group := l.hostGroups[address]
+	key := hostGroup{address: address, group: group}
+	slots, ok := l.hostSlots[key]
+	if !ok {
+		perHost := l.perHost
+		if g, found := l.groups[group]; found && g.PerHost > 0 {
+			perHost = g.PerHost
+		}
+		if perHost > 0 {
+			slots = make(chan struct{}, perHost)
+		}
+		l.hostSlots[key] = slots
+	}
+	groupLimiter := l.groupLimiters[group]
+	l.mu.Unlock()
+
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return func() {}, ctx.Err()
+		}
+	}
+	release = func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+	if err = wait(ctx, l.global, packets); err == nil {
+		err = wait(ctx, groupLimiter, packets)
+	}
+	if err != nil {
+		release()
+		return func() {}, err
+	}
+	return release, nil
+}
+
+// Wait waits for packets budget only, for senders without per host probes
+func (l *RateLimiter) Wait(ctx context.Context, address string, packets int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	groupLimiter := l.groupLimiters[l.hostGroups[address]]
+	l.mu.Unlock()
+	if err := wait(ctx, l.global, packets); err != nil {
+		return err
+	}
+	return wait(ctx, groupLimiter, packets)
+}
+
+func wait(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return ctx.Err()
+	}
+	for ; n > 0; n-- {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseGroupLimits parses group overrides like "sockets:5:1", that is group:pps:per-host
+func ParseGroupLimits(specs []string) (map[string]GroupLimit, error) {
+	groups := make(map[string]GroupLimit, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid group limit %q, expected group:pps:per-host", spec)
+		}
+		pps, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid group limit %q, %w", spec, err)
+		}
+		perHost, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid group limit %q, %w", spec, err)
+		}
+		groups[parts[0]] = GroupLimit{PPS: pps, PerHost: perHost}
+	}
+	return groups, nil
+}
@@ -0,0 +1,159 @@
+package netutils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// acquireWithin acquires probe slot if it is free within d
+func acquireWithin(l *RateLimiter, address string, d time.Duration) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return l.Acquire(ctx, address, 1)
+}
+
+func TestRateLimiterPPS(t *testing.T) {
+	l := NewRateLimiter(50, 0, nil)
+	start := time.Now()
+	for range 4 {
+		release, err := l.Acquire(context.Background(), "192.168.2.10", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	// packets of several probes share the budget
+	if err := l.Wait(context.Background(), "192.168.2.11", 2); err != nil {
+		t.Fatal(err)
+	}
+	// burst of 1, then 5 packets at 20ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("6 packets at 50 pps took %v", elapsed)
+	}
+}
+
+func TestRateLimiterPerHost(t *testing.T) {
+	l := NewRateLimiter(0, 1, nil)
+	release, err := acquireWithin(l, "192.168.2.10", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = acquireWithin(l, "192.168.2.10", 30*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second probe of host error = %v, want deadline exceeded", err)
+	}
+	other, err := acquireWithin(l, "192.168.2.11", 30*time.Millisecond)
+	if err != nil {
+		t.Errorf("probe of other host: %v", err)
+	}
+	other()
+	release()
+	release, err = acquireWithin(l, "192.168.2.10", 30*time.Millisecond)
+	if err != nil {
+		t.Errorf("probe after release: %v", err)
+	}
+	release()
+}
+
+func TestRateLimiterGroups(t *testing.T) {
+	l := NewRateLimiter(0, 0, map[string]GroupLimit{"sockets": {PerHost: 1}, "cameras": {PPS: 20}})
+
+	// host is probed before its group is known, e.g. pinged before name lookup
+	release, err := acquireWithin(l, "192.168.2.50", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	l.SetHostGroup("192.168.2.50", "sockets")
+
+	release, err = acquireWithin(l, "192.168.2.50", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = acquireWithin(l, "192.168.2.50", 30*time.Millisecond); err == nil {
+		t.Error("group per host cap is not applied after SetHostGroup")
+	}
+	release()
+
+	// group budget does not slow down hosts of other groups
+	l.SetHostGroup("192.168.2.60", "cameras")
+	start := time.Now()
+	for range 5 {
+		if err = l.Wait(context.Background(), "192.168.2.51", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("host without group waited %v", elapsed)
+	}
+	start = time.Now()
+	for range 3 {
+		if err = l.Wait(context.Background(), "192.168.2.60", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("3 packets at group 20 pps took %v", elapsed)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var unlimited *RateLimiter
+	if _, err := unlimited.Acquire(ctx, "192.168.2.10", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("nil limiter Acquire error = %v, want canceled", err)
+	}
+	if err := unlimited.Wait(ctx, "192.168.2.10", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("nil limiter Wait error = %v, want canceled", err)
+	}
+
+	l := NewRateLimiter(1, 1, nil)
+	// first packet uses the burst, second one would wait a second
+	release, err := l.Acquire(context.Background(), "192.168.2.10", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err = l.Acquire(ctx, "192.168.2.11", 1); err == nil {
+		t.Error("Acquire succeeded beyond budget")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled Acquire returned after %v", elapsed)
+	}
+	release()
+
+	// slot of host taken by failed Acquire is released
+	l = NewRateLimiter(0, 1, nil)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = l.Acquire(ctx, "192.168.2.10", 1); err == nil {
+		t.Error("Acquire with cancelled context succeeded")
+	}
+	release, err = acquireWithin(l, "192.168.2.10", 30*time.Millisecond)
+	if err != nil {
+		t.Errorf("slot is not released by failed Acquire: %v", err)
+	}
+	release()
+}
+
+func TestParseGroupLimits(t *testing.T) {
+	got, err := ParseGroupLimits([]string{"sockets:5:1", "cameras:0:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]GroupLimit{"sockets": {PPS: 5, PerHost: 1}, "cameras": {PPS: 0, PerHost: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseGroupLimits = %v, want %v", got, want)
+	}
+	for _, spec := range []string{"sockets", "sockets:5", ":5:1", "sockets:x:1", "sockets:5:x", "a:1:2:3"} {
+		if _, err := ParseGroupLimits([]string{spec}); err == nil {
+			t.Errorf("ParseGroupLimits(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package netutils
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Resolver finds host names for ip addresses: PTR first, then NetBIOS and mDNS.
+// Results (including misses) are cached for the resolver lifetime
+type Resolver struct {
+	Server  string
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+/*
+server - dns server address [host:port], system resolver if empty
+*/
+func NewResolver(server string) *Resolver {
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+	}
+	return &Resolver{
+		Server:  server,
+		Timeout: 1 * time.Second,
+		cache:   make(map[string]string),
+	}
+}
+
+// LookupName returns host name for ip, empty string if nothing was found or ctx is done
+func (r *Resolver) LookupName(ctx context.Context, ip string) string {
+	r.mu.Lock()
+	name, ok := r.cache[ip]
+	r.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	name = r.lookupPTR(ctx, ip)
+	if name == "" {
+		name = r.lookupNetBIOS(ctx, ip)
+	}
+	if name == "" {
+		name = r.lookupMDNS(ctx, ip)
+	}
+	if ctx.Err() != nil {
+		// do not cache interrupted lookups
+		return name
+	}
+	logger.WithFields(logger.Fields{
+		"function": "LookupName",
+		"ip":       ip,
+	}).Debugf("Resolved name: %q", name)
+
+	r.mu.Lock()
+	r.cache[ip] = name
+	r.mu.Unlock()
+	return name
+}
+
+// Enrich resolves names of hosts without host name and returns them as inventory,
+// ip is used as host name when no name was found
+func (r *Resolver) Enrich(ctx context.Context, hosts []Host, threads int) Inventory {
+	tokens := make(chan struct{}, threads)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inv := make(Inventory, len(hosts))
+
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h Host) {
+			defer wg.Done()
+			if h.Hostname == "" {
+				tokens <- struct{}{}
+				h.Hostname = r.LookupName(ctx, h.IP)
+				<-tokens
+			}
+			if h.Hostname == "" {
+				h.Hostname = h.IP
+			}
+			mu.Lock()
+			inv.Add(h)
+			mu.Unlock()
+		}(h)
+	}
+	wg.Wait()
+	return inv
+}
+
+func (r *Resolver) lookupPTR(ctx context.Context, ip string) string {
+	if r.Server == "" {
+		names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+		if err != nil || len(names) == 0 {
+			return ""
+		}
+		return strings.TrimSuffix(names[0], ".")
+	}
+	return r.queryPTR(ctx, ip, r.Server)
+}
+
+// lookupMDNS asks the host itself for its reverse name over unicast mDNS
+func (r *Resolver) lookupMDNS(ctx context.Context, ip string) string {
+	return r.queryPTR(ctx, ip, net.JoinHostPort(ip, "5353"))
+}
+
+func (r *Resolver) queryPTR(ctx context.Context, ip, server string) string {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(arpa, dns.TypePTR)
+	c := &dns.Client{Timeout: r.Timeout}
+	in, _, err := c.ExchangeContext(ctx, m, server)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"function": "queryPTR",
+			"ip":       ip,
+			"server":   server,
+		}).Debugln(err)
+		return ""
+	}
+	for _, rr := range in.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return mdnsHostname(ptr.Ptr)
+		}
+	}
+	return ""
+}
+
+// nbstatRequest is a NetBIOS node status query for wildcard name "*"
+var nbstatRequest = []byte{
+	0x13, 0x37, // transaction id
+	0x00, 0x00, // flags
+	0x00, 0x01, // questions
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x20, 'C', 'K', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A',
+	'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 'A', 0x00,
+	0x00, 0x21, // type NBSTAT
+	0x00, 0x01, // class IN
+}
+
+// lookupNetBIOS sends node status request and returns the workstation name
+func (r *Resolver) lookupNetBIOS(ctx context.Context, ip string) string {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(ip, strconv.Itoa(137)))
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	if _, err = conn.Write(nbstatRequest); err != nil {
+		return ""
+	}
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return parseNBStat(buf[:n])
+}
+
+func parseNBStat(b []byte) string {
+	// header(12) + name(34) + type, class, ttl, rdlength(10)
+	const offset = 56
+	if len(b) <= offset {
+		return ""
+	}
+	count := int(b[offset])
+	for i := 0; i < count; i++ {
+		start := offset + 1 + i*18
+		if start+18 > len(b) {
+			break
+		}
+		entry := b[start : start+18]
+		suffix := entry[15]
+		flags := binary.BigEndian.Uint16(entry[16:18])
+		// unique workstation name
+		if suffix == 0x00 && flags&0x8000 == 0 {
+			return strings.ToLower(strings.TrimSpace(string(entry[:15])))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package netutils
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// nbstatResponse builds node status response with names of 15 characters padded by spaces
+func nbstatResponse(names []string, suffixes []byte, flags []uint16) []byte {
+	b := make([]byte, 56, 57+18*len(names))
+	b = append(b, byte(len(names)))
+	for i, name := range names {
+		entry := make([]byte, 18)
+		copy(entry, name)
+		for j := len(name); j < 15; j++ {
+			entry[j] = ' '
+		}
+		entry[15] = suffixes[i]
+		entry[16], entry[17] = byte(flags[i]>>8), byte(flags[i])
+		b = append(b, entry...)
+	}
+	return b
+}
+
+func TestParseNBStat(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{name: "workstation name", want: "nas",
+			b: nbstatResponse([]string{"NAS", "NAS", "WORKGROUP"}, []byte{0x00, 0x20, 0x00}, []uint16{0x0400, 0x0400, 0x8400})},
+		{name: "group name is skipped", want: "printer",
+			b: nbstatResponse([]string{"WORKGROUP", "PRINTER"}, []byte{0x00, 0x00}, []uint16{0x8400, 0x0400})},
+		{name: "file server only",
+			b: nbstatResponse([]string{"NAS"}, []byte{0x20}, []uint16{0x0400})},
+		{name: "no names", b: nbstatResponse(nil, nil, nil)},
+		{name: "truncated header", b: make([]byte, 40)},
+		{name: "truncated entries",
+			b: nbstatResponse([]string{"NAS"}, []byte{0x00}, []uint16{0x0400})[:60]},
+		{name: "count exceeds entries", want: "", b: func() []byte {
+			b := nbstatResponse([]string{"WORKGROUP"}, []byte{0x00}, []uint16{0x8400})
+			b[56] = 5
+			return b
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNBStat(tt.b); got != tt.want {
+				t.Errorf("parseNBStat = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolverPTR(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			if r.Question[0].Name == "10.2.168.192.in-addr.arpa." {
+				m.Answer = append(m.Answer, &dns.PTR{
+					Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 60},
+					Ptr: "host1.example.test.",
+				})
+			}
+			_ = w.WriteMsg(m)
+		}),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	defer srv.Shutdown()
+
+	r := NewResolver(pc.LocalAddr().String())
+	if got := r.lookupPTR(context.Background(), "192.168.2.10"); got != "host1.example.test" {
+		t.Errorf("lookupPTR = %q, want host1.example.test", got)
+	}
+	if got := r.lookupPTR(context.Background(), "192.168.2.11"); got != "" {
+		t.Errorf("lookupPTR of unknown ip = %q, want empty", got)
+	}
+}
@@ -0,0 +1,247 @@
+package netutils
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+//go:generate curl -sSfL -o service-names-port-numbers.csv https://www.iana.org/assignments/service-names-port-numbers/service-names-port-numbers.csv
+
+// ianaServices is IANA Service Name and Transport Protocol Port Number Registry in its csv format
+//
+//go:embed service-names-port-numbers.csv
+var ianaServices []byte
+
+// siteServices are applications usually found on their default ports in our networks,
+// in /etc/services format. They take precedence over IANA and system names of these ports
+//
+//go:embed site-services.txt
+var siteServices []byte
+
+// systemServicesFile is the local services database, its names take precedence over IANA ones
+const systemServicesFile = "/etc/services"
+
+// servicePort is a port of transport protocol
+type servicePort struct {
+	port  int
+	proto string
+}
+
+// ServiceRegistry names services by port and protocol, later added names override earlier ones
+type ServiceRegistry struct {
+	names map[servicePort]string
+	// ports are keyed by lower case names and aliases
+	ports map[string][]servicePort
+}
+
+// services is used for service names of probe results and port specs of scan profiles
+var services = defaultServices()
+
+// NewServiceRegistry returns empty registry
+func NewServiceRegistry() *ServiceRegistry {
+	return &ServiceRegistry{
+		names: make(map[servicePort]string),
+		ports: make(map[string][]servicePort),
+	}
+}
+
+// Add registers service name and its aliases for port, name of port set earlier is replaced
+func (r *ServiceRegistry) Add(name string, port int, proto string, aliases ...string) {
+	sp := servicePort{port: port, proto: strings.ToLower(proto)}
+	r.names[sp] = name
+	for _, n := range append([]string{name}, aliases...) {
+		key := strings.ToLower(n)
+		if !slices.Contains(r.ports[key], sp) {
+			r.ports[key] = append(r.ports[key], sp)
+		}
+	}
+}
+
+// Name returns service name of port, false if port is unknown
+func (r *ServiceRegistry) Name(proto string, port int) (string, bool) {
+	name, ok := r.names[servicePort{port: port, proto: strings.ToLower(proto)}]
+	return name, ok
+}
+
+// Ports returns ports of service name or alias for protocol in order they were added
+func (r *ServiceRegistry) Ports(name, proto string) []int {
+	var ports []int
+	for _, sp := range r.ports[strings.ToLower(name)] {
+		if sp.proto == strings.ToLower(proto) {
+			ports = append(ports, sp.port)
+		}
+	}
+	return ports
+}
+
+// Len returns number of known ports
+func (r *ServiceRegistry) Len() int {
+	return len(r.names)
+}
+
+// Read adds services from data in /etc/services format:
+//
+//	name port/protocol [aliases ...] [# comment]
+func (r *ServiceRegistry) Read(rd io.Reader) error {
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("line %d: no port/protocol of service %s", line, fields[0])
+		}
+		num, proto, ok := strings.Cut(fields[1], "/")
+		port, err := strconv.Atoi(num)
+		if !ok || proto == "" || err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("line %d: invalid port/protocol %q", line, fields[1])
+		}
+		r.Add(fields[0], port, proto, fields[2:]...)
+	}
+	return sc.Err()
+}
+
+// ReadIANA adds services from IANA registry csv. The first name of a port is kept,
+// later ones become its aliases. Records without name, port or protocol are skipped, lines
+// starting with # are comments
+func (r *ServiceRegistry) ReadIANA(rd io.Reader) error {
+	cr := csv.NewReader(rd)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("no header, %w", err)
+	}
+	nameCol, portCol, protoCol := slices.Index(header, "Service Name"), slices.Index(header, "Port Number"), slices.Index(header, "Transport Protocol")
+	if nameCol < 0 || portCol < 0 || protoCol < 0 {
+		return errors.New("no service name, port number or transport protocol column")
+	}
+	named := make(map[servicePort]bool)
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) <= max(nameCol, portCol, protoCol) || rec[nameCol] == "" || rec[portCol] == "" || rec[protoCol] == "" {
+			continue
+		}
+		line, _ := cr.FieldPos(portCol)
+		first, last, err := parseServicePorts(rec[portCol])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		proto := strings.ToLower(rec[protoCol])
+		for port := first; port <= last; port++ {
+			sp := servicePort{port: port, proto: proto}
+			if named[sp] {
+				r.Add(r.names[sp], port, proto, rec[nameCol])
+				continue
+			}
+			named[sp] = true
+			r.Add(rec[nameCol], port, proto)
+		}
+	}
+}
+
+// parseServicePorts parses port or range like 6000-6063 of IANA registry, port 0 is reserved there but valid
+func parseServicePorts(s string) (first, last int, err error) {
+	from, to, isRange := strings.Cut(s, "-")
+	first, err = strconv.Atoi(from)
+	last = first
+	if err == nil && isRange {
+		last, err = strconv.Atoi(to)
+	}
+	if err != nil || first < 0 || last > 65535 || last < first {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	return first, last, nil
+}
+
+// LoadFile adds services from file in /etc/services format
+func (r *ServiceRegistry) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to read services file %s, %w", path, err)
+	}
+	defer f.Close()
+	if err = r.Read(f); err != nil {
+		return fmt.Errorf("unable to parse services file %s, %w", path, err)
+	}
+	return nil
+}
+
+// Services returns registry used by probes
+func Services() *ServiceRegistry {
+	return services
+}
+
+/*
+LoadServices builds registry from embedded IANA registry, local /etc/services,
+embedded site services and overrides file in /etc/services format, each source
+overrides names of the previous ones. Registry of a previous call is replaced.
+Overrides are not read if path is empty:
+
+	mikrotik-api	8728/tcp	api
+	shelly		8080/tcp
+*/
+func LoadServices(overrides string) error {
+	r := ianaRegistry()
+	err := r.LoadFile(systemServicesFile)
+	if err != nil {
+		lvl := logger.WarnLevel
+		if errors.Is(err, fs.ErrNotExist) {
+			lvl = logger.DebugLevel
+		}
+		logger.WithFields(logger.Fields{
+			"function": "LoadServices",
+			"file":     systemServicesFile,
+		}).Logln(lvl, err)
+	}
+	addSiteServices(r)
+	if overrides != "" {
+		if err = r.LoadFile(overrides); err != nil {
+			return err
+		}
+	}
+	logger.WithFields(logger.Fields{"function": "LoadServices"}).Debugf("Loaded %d service ports", r.Len())
+	services = r
+	return nil
+}
+
+// defaultServices returns registry of IANA services and site services
+func defaultServices() *ServiceRegistry {
+	r := ianaRegistry()
+	addSiteServices(r)
+	return r
+}
+
+func ianaRegistry() *ServiceRegistry {
+	r := NewServiceRegistry()
+	if err := r.ReadIANA(bytes.NewReader(ianaServices)); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func addSiteServices(r *ServiceRegistry) {
+	if err := r.Read(bytes.NewReader(siteServices)); err != nil {
+		panic(err)
+	}
+}
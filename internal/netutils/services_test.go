@@ -0,0 +1,268 @@
+package netutils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestServiceRegistryRead(t *testing.T) {
+	r := NewServiceRegistry()
+	err := r.Read(strings.NewReader(`# comment
+http		80/tcp		www	# World Wide Web
+domain		53/tcp		dns
+domain		53/UDP		dns
+
+webcache	8080/tcp	http-alt
+shelly		8080/tcp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []struct {
+		proto string
+		port  int
+		name  string
+		ok    bool
+	}{
+		{ProtoTCP, 80, "http", true},
+		{ProtoUDP, 53, "domain", true},
+		{"UDP", 53, "domain", true},
+		// later name of port wins
+		{ProtoTCP, 8080, "shelly", true},
+		{ProtoUDP, 80, "", false},
+		{ProtoTCP, 443, "", false},
+	}
+	for _, tt := range names {
+		if name, ok := r.Name(tt.proto, tt.port); name != tt.name || ok != tt.ok {
+			t.Errorf("Name(%s, %d) = %q, %v, want %q, %v", tt.proto, tt.port, name, ok, tt.name, tt.ok)
+		}
+	}
+
+	ports := []struct {
+		name, proto string
+		want        []int
+	}{
+		{"http", ProtoTCP, []int{80}},
+		{"WWW", ProtoTCP, []int{80}},
+		{"dns", ProtoUDP, []int{53}},
+		{"http-alt", ProtoTCP, []int{8080}},
+		{"webcache", ProtoTCP, []int{8080}},
+		{"http", ProtoUDP, nil},
+		{"ssh", ProtoTCP, nil},
+	}
+	for _, tt := range ports {
+		if got := r.Ports(tt.name, tt.proto); !slices.Equal(got, tt.want) {
+			t.Errorf("Ports(%s, %s) = %v, want %v", tt.name, tt.proto, got, tt.want)
+		}
+	}
+	if r.Len() != 4 {
+		t.Errorf("Len = %d, want 4", r.Len())
+	}
+}
+
+func TestServiceRegistryReadErrors(t *testing.T) {
+	tests := []struct {
+		name, data, err string
+	}{
+		{name: "no port", data: "http\n", err: "line 1: no port/protocol"},
+		{name: "no protocol", data: "\nhttp 80\n", err: "line 2: invalid port/protocol"},
+		{name: "empty protocol", data: "http 80/\n", err: "invalid port/protocol"},
+		{name: "port is not a number", data: "http www/tcp\n", err: "invalid port/protocol"},
+		{name: "port out of range", data: "http 65536/tcp\n", err: "invalid port/protocol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewServiceRegistry().Read(strings.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestServiceRegistryReadIANA(t *testing.T) {
+	r := NewServiceRegistry()
+	err := r.ReadIANA(strings.NewReader(`# local copy
+Service Name,Port Number,Transport Protocol,Description,Assignee,Contact,Registration Date,Modification Date,Reference,Service Code,Unauthorized Use Reported,Assignment Notes
+,0,tcp,Reserved,,,,,,,,
+http,80,tcp,World Wide Web HTTP,,,,,,,,
+www,80,tcp,World Wide Web HTTP,,,,,,,,
+x11,6000-6002,tcp,"X Window System, display",,,,,,,,
+domain,53,udp,Domain Name Server,,,,,,,,
+DOMAIN,53,tcp,Domain Name Server,,,,,,,,
+unassigned,,tcp,,,,,,,,,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		proto string
+		port  int
+		name  string
+	}{
+		// first name of port wins
+		{ProtoTCP, 80, "http"},
+		{ProtoTCP, 6001, "x11"},
+		{ProtoTCP, 6002, "x11"},
+		{ProtoUDP, 53, "domain"},
+		{ProtoTCP, 53, "DOMAIN"},
+		{ProtoTCP, 0, ""},
+		{ProtoTCP, 6003, ""},
+	} {
+		if name, _ := r.Name(tt.proto, tt.port); name != tt.name {
+			t.Errorf("Name(%s, %d) = %q, want %q", tt.proto, tt.port, name, tt.name)
+		}
+	}
+	if ports := r.Ports("www", ProtoTCP); !slices.Equal(ports, []int{80}) {
+		t.Errorf("Ports(www) = %v, want [80]", ports)
+	}
+	if r.Len() != 6 {
+		t.Errorf("Len = %d, want 6", r.Len())
+	}
+}
+
+func TestServiceRegistryReadIANAErrors(t *testing.T) {
+	const header = "Service Name,Port Number,Transport Protocol\n"
+	tests := []struct {
+		name, data, err string
+	}{
+		{name: "empty", data: "", err: "no header"},
+		{name: "no port column", data: "Service Name,Transport Protocol\nhttp,tcp\n", err: "no service name, port number"},
+		{name: "port is not a number", data: header + "http,www,tcp\n", err: `line 2: invalid port "www"`},
+		{name: "port out of range", data: header + "http,65536,tcp\n", err: "invalid port"},
+		{name: "reversed range", data: header + "x11,6063-6000,tcp\n", err: "invalid port"},
+		{name: "invalid csv", data: header + "http,\"80,tcp\n", err: "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewServiceRegistry().ReadIANA(strings.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDefaultServices(t *testing.T) {
+	r := defaultServices()
+	for _, tt := range []struct {
+		proto string
+		port  int
+		name  string
+	}{
+		{ProtoTCP, 22, "ssh"},
+		{ProtoTCP, 80, "http"},
+		{ProtoUDP, 53, "domain"},
+		{ProtoUDP, 161, "snmp"},
+		// site services override IANA names
+		{ProtoTCP, 9100, "node_exporter"},
+		{ProtoTCP, 8123, "home-assistant"},
+		{ProtoUDP, 54321, "miio"},
+	} {
+		if name, _ := r.Name(tt.proto, tt.port); name != tt.name {
+			t.Errorf("Name(%s, %d) = %q, want %q", tt.proto, tt.port, name, tt.name)
+		}
+	}
+	if ports := r.Ports("www", ProtoTCP); !slices.Contains(ports, 80) {
+		t.Errorf("Ports(www) = %v, want 80", ports)
+	}
+}
+
+func TestLoadServices(t *testing.T) {
+	loaded := services
+	t.Cleanup(func() { services = loaded })
+
+	overrides := writeTestFile(t, "services", `
+mikrotik-api	8728/tcp	api
+hass		8123/tcp
+`)
+	if err := LoadServices(overrides); err != nil {
+		t.Fatal(err)
+	}
+	n := Services().Len()
+	for _, tt := range []struct {
+		port int
+		name string
+	}{
+		{22, "ssh"},
+		// site services override port names of lists
+		{9100, "node_exporter"},
+		// overrides file wins over site services
+		{8123, "hass"},
+		{8728, "mikrotik-api"},
+	} {
+		if name, _ := Services().Name(ProtoTCP, tt.port); name != tt.name {
+			t.Errorf("Name(tcp, %d) = %q, want %q", tt.port, name, tt.name)
+		}
+	}
+	if ports := Services().Ports("api", ProtoTCP); !slices.Equal(ports, []int{8728}) {
+		t.Errorf("Ports(api) = %v, want [8728]", ports)
+	}
+
+	// registry is rebuilt on every load
+	if err := LoadServices(overrides); err != nil {
+		t.Fatal(err)
+	}
+	if Services().Len() != n {
+		t.Errorf("second load has %d ports, first %d", Services().Len(), n)
+	}
+	if err := LoadServices(""); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := Services().Name(ProtoTCP, 8123); name != "home-assistant" {
+		t.Errorf("Name(tcp, 8123) = %q after load without overrides, want home-assistant", name)
+	}
+
+	if err := LoadServices(writeTestFile(t, "bad", "api 8728\n")); err == nil {
+		t.Error("LoadServices of invalid overrides succeeded")
+	}
+	if err := LoadServices(overrides + ".missing"); err == nil {
+		t.Error("LoadServices of missing overrides succeeded")
+	}
+}
+
+func TestParsePortSpecsNames(t *testing.T) {
+	loaded := services
+	t.Cleanup(func() { services = loaded })
+	services = NewServiceRegistry()
+	services.Add("9pfs", 564, ProtoTCP)
+	services.Add("3com-tsmux", 106, ProtoTCP)
+	services.Add("topflow", 8888, ProtoTCP)
+	services.Add("22", 2222, ProtoTCP)
+
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"9pfs", []int{564}},
+		{"3com-tsmux", []int{106}},
+		{"topflow", []int{8888}},
+		{"top2", []int{80, 23}},
+		// numbers win over names
+		{"22", []int{22}},
+		{"100-101", []int{100, 101}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePortSpecs([]string{tt.spec}, ProtoTCP)
+		if err != nil {
+			t.Errorf("ParsePortSpecs(%q): %v", tt.spec, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParsePortSpecs(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for spec, err := range map[string]string{
+		"9unknown": "invalid port",
+		"100-90":   "invalid port range",
+		"topx":     "unknown tcp service",
+		"unknown":  "unknown tcp service",
+	} {
+		if _, got := ParsePortSpecs([]string{spec}, ProtoTCP); got == nil || !strings.Contains(got.Error(), err) {
+			t.Errorf("ParsePortSpecs(%q) error = %v, want %q", spec, got, err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package netutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/time/rate"
+)
+
+// sweepMagic marks echo payloads sent by this process, followed by send time
+var sweepMagic = []byte("chd-sweep")
+
+// Sweeper sends ICMP echo requests to the whole target set from one socket
+// per address family. Replies are matched by sequence, source address and payload,
+// identifier is checked on privileged sockets only as the kernel owns it otherwise
+type Sweeper struct {
+	Privileged bool
+	Count      int
+	Interval   time.Duration
+	Timeout    time.Duration
+	// PPS limits echo requests per second, unlimited if 0
+	PPS int
+
+	id uint16
+}
+
+// NewSweeper returns sweeper with ping options and packets per second budget
+func NewSweeper(opts PingOptions, pps int) *Sweeper {
+	if opts.Count < 1 {
+		opts.Count = 1
+	}
+	return &Sweeper{
+		Privileged: opts.Privileged,
+		Count:      opts.Count,
+		Interval:   opts.Interval,
+		Timeout:    opts.Timeout,
+		PPS:        pps,
+		id:         uint16(os.Getpid() & 0xffff),
+	}
+}
+
+type sweepConn struct {
+	conn  *icmp.PacketConn
+	proto int
+	echo  icmp.Type
+	reply icmp.Type
+}
+
+type sweepStats struct {
+	recv int
+	rtts []time.Duration
+}
+
+// sweepState tracks echo requests in flight and replies to them
+type sweepState struct {
+	mu sync.Mutex
+	// pending maps sequence of request in flight to its target, it is
+	// bounded by sequence space and an entry is dropped on its reply
+	pending map[uint16]netip.Addr
+	// sent counts successfully sent requests per target
+	sent  map[netip.Addr]int
+	stats map[netip.Addr]*sweepStats
+}
+
+func newSweepState() *sweepState {
+	return &sweepState{
+		pending: make(map[uint16]netip.Addr),
+		sent:    make(map[netip.Addr]int),
+		stats:   make(map[netip.Addr]*sweepStats),
+	}
+}
+
+// track registers request before it is sent, so a fast reply is not missed
+func (st *sweepState) track(seq uint16, addr netip.Addr) {
+	st.mu.Lock()
+	st.pending[seq] = addr
+	st.mu.Unlock()
+}
+
+// sendResult counts sent request or forgets it if send failed
+func (st *sweepState) sendResult(seq uint16, addr netip.Addr, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err != nil {
+		if st.pending[seq] == addr {
+			delete(st.pending, seq)
+		}
+		return
+	}
+	st.sent[addr]++
+}
+
+// reply records reply to request seq from peer, false if it does not match a request in flight
+func (st *sweepState) reply(seq uint16, peer netip.Addr, rtt time.Duration) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	target, ok := st.pending[seq]
+	if !ok || target.WithZone("") != peer {
+		return false
+	}
+	delete(st.pending, seq)
+	stats, found := st.stats[target]
+	if !found {
+		stats = &sweepStats{}
+		st.stats[target] = stats
+	}
+	stats.recv++
+	stats.rtts = append(stats.rtts, rtt)
+	return true
+}
+
+func (s *Sweeper) listen(v6 bool) (*sweepConn, error) {
+	network, address := "udp4", "0.0.0.0"
+	sc := &sweepConn{proto: 1, echo: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	if v6 {
+		network, address = "udp6", "::"
+		sc = &sweepConn{proto: 58, echo: ipv6.ICMPTypeEchoRequest, reply: ipv6.ICMPTypeEchoReply}
+	}
+	if s.Privileged {
+		network = map[bool]string{false: "ip4:icmp", true: "ip6:ipv6-icmp"}[v6]
+	}
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open icmp socket %s, %w", network, err)
+	}
+	sc.conn = conn
+	return sc, nil
+}
+
+// Sweep pings every address Count times and returns results of alive hosts.
+// Targets are read lazily, memory grows with number of targets sent to.
+// Sending stops when ctx is done, replies received so far are returned
+func (s *Sweeper) Sweep(ctx context.Context, addrs iter.Seq[string]) ([]PingResult, error) {
+	conns := make(map[bool]*sweepConn)
+	defer func() {
+		for _, c := range conns {
+			c.conn.Close()
+		}
+	}()
+
+	state := newSweepState()
+	var wg sync.WaitGroup
+
+	receive := func(sc *sweepConn) {
+		defer wg.Done()
+		buf := make([]byte, 1500)
+		for {
+			n, peer, err := sc.conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			seq, rtt, ok := s.parseReply(sc, buf[:n])
+			if !ok {
+				continue
+			}
+			if !state.reply(seq, peerAddr(peer), rtt) {
+				logger.WithFields(logger.Fields{
+					"function": "Sweeper.Sweep",
+					"peer":     peer.String(),
+					"seq":      seq,
+				}).Debugln("Unexpected echo reply")
+			}
+		}
+	}
+
+	var limiter *rate.Limiter
+	if s.PPS > 0 {
+		limiter = rate.NewLimiter(rate.Limit(s.PPS), 1)
+	}
+
+	var sent int
+	var seq uint16
+send:
+	for round := 0; round < s.Count; round++ {
+		if round > 0 && s.Interval > 0 {
+			select {
+			case <-time.After(s.Interval):
+			case <-ctx.Done():
+				break send
+			}
+		}
+		for address := range addrs {
+			addr, err := netip.ParseAddr(address)
+			if err != nil {
+				continue
+			}
+			v6 := !addr.Unmap().Is4()
+			sc, ok := conns[v6]
+			if !ok {
+				if sc, err = s.listen(v6); err != nil {
+					return nil, err
+				}
+				conns[v6] = sc
+				wg.Add(1)
+				go receive(sc)
+			}
+			if limiter != nil {
+				if err = limiter.Wait(ctx); err != nil {
+					break send
+				}
+			}
+			if err = probeLimiter.Wait(ctx, address, 1); err != nil {
+				break send
+			}
+			seq++
+			addr = addr.Unmap()
+			state.track(seq, addr)
+			err = s.send(sc, addr, seq)
+			state.sendResult(seq, addr, err)
+			if err != nil {
+				logger.WithFields(logger.Fields{
+					"function": "Sweeper.Sweep",
+					"address":  address,
+				}).Debugln(err)
+				continue
+			}
+			sent++
+		}
+	}
+	logger.WithFields(logger.Fields{
+		"function": "Sweeper.Sweep",
+	}).Debugf("Sent %d echo requests", sent)
+
+	// wait for late replies, then stop receivers
+	select {
+	case <-time.After(s.Timeout):
+	case <-ctx.Done():
+	}
+	for _, c := range conns {
+		_ = c.conn.SetReadDeadline(time.Now())
+	}
+	wg.Wait()
+
+	return state.results(), nil
+}
+
+func (s *Sweeper) send(sc *sweepConn, addr netip.Addr, seq uint16) error {
+	payload := make([]byte, len(sweepMagic)+8)
+	copy(payload, sweepMagic)
+	binary.BigEndian.PutUint64(payload[len(sweepMagic):], uint64(time.Now().UnixNano()))
+	msg := icmp.Message{
+		Type: sc.echo,
+		Body: &icmp.Echo{ID: int(s.id), Seq: int(seq), Data: payload},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: addr.AsSlice()}
+	if s.Privileged {
+		dst = &net.IPAddr{IP: addr.AsSlice()}
+	}
+	_, err = sc.conn.WriteTo(b, dst)
+	return err
+}
+
+// parseReply returns sequence and rtt of echo reply to request of this sweeper
+func (s *Sweeper) parseReply(sc *sweepConn, b []byte) (uint16, time.Duration, bool) {
+	msg, err := icmp.ParseMessage(sc.proto, b)
+	if err != nil || msg.Type != sc.reply {
+		return 0, 0, false
+	}
+	echo, ok := msg.Body.(*icmp.Echo)
+	if !ok || !bytes.HasPrefix(echo.Data, sweepMagic) || len(echo.Data) < len(sweepMagic)+8 {
+		return 0, 0, false
+	}
+	// kernel replaces identifier with socket port for unprivileged sockets
+	if s.Privileged && echo.ID != int(s.id) {
+		return 0, 0, false
+	}
+	sentAt := int64(binary.BigEndian.Uint64(echo.Data[len(sweepMagic):]))
+	return uint16(echo.Seq), time.Since(time.Unix(0, sentAt)), true
+}
+
+// results returns statistics of hosts which replied
+func (st *sweepState) results() []PingResult {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	results := make([]PingResult, 0, len(st.stats))
+	for addr, stats := range st.stats {
+		results = append(results, sweepResult(addr.String(), st.sent[addr], stats))
+	}
+	return results
+}
+
+func sweepResult(ip string, sent int, st *sweepStats) PingResult {
+	res := PingResult{IP: ip, Alive: st.recv > 0, Method: LivenessICMP, Sent: sent, Recv: st.recv}
+	if res.Recv > res.Sent {
+		// reply to a request sent before sequence wrapped around
+		res.Recv = res.Sent
+	}
+	if res.Sent > 0 {
+		res.Loss = float64(res.Sent-res.Recv) / float64(res.Sent) * 100
+	}
+
+	var sum time.Duration
+	for i, rtt := range st.rtts {
+		if i == 0 || rtt < res.MinRTT {
+			res.MinRTT = rtt
+		}
+		if rtt > res.MaxRTT {
+			res.MaxRTT = rtt
+		}
+		sum += rtt
+	}
+	res.AvgRTT = sum / time.Duration(len(st.rtts))
+	var variance float64
+	for _, rtt := range st.rtts {
+		d := float64(rtt - res.AvgRTT)
+		variance += d * d
+	}
+	res.Jitter = time.Duration(math.Sqrt(variance / float64(len(st.rtts))))
+	return res
+}
+
+// peerAddr returns address of reply sender, invalid address if it is unknown
+func peerAddr(addr net.Addr) netip.Addr {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	}
+	peer, _ := netip.AddrFromSlice(ip)
+	return peer.Unmap()
+}
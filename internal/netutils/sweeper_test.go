@@ -0,0 +1,127 @@
+package netutils
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func TestSweepStateReplies(t *testing.T) {
+	a := netip.MustParseAddr("192.168.2.10")
+	b := netip.MustParseAddr("192.168.2.11")
+	st := newSweepState()
+
+	st.track(1, a)
+	st.sendResult(1, a, nil)
+	st.track(2, b)
+	st.sendResult(2, b, nil)
+	st.track(3, a)
+	st.sendResult(3, a, errors.New("no route to host"))
+	st.track(4, a)
+	st.sendResult(4, a, nil)
+
+	tests := []struct {
+		name string
+		seq  uint16
+		peer netip.Addr
+		want bool
+	}{
+		{name: "reply from target", seq: 1, peer: a, want: true},
+		{name: "duplicate reply", seq: 1, peer: a},
+		{name: "reply from other host", seq: 2, peer: a},
+		{name: "reply to failed send", seq: 3, peer: a},
+		{name: "unknown sequence", seq: 9, peer: a},
+		{name: "second reply from target", seq: 4, peer: a, want: true},
+		{name: "reply from other target", seq: 2, peer: b, want: true},
+	}
+	for _, tt := range tests {
+		if got := st.reply(tt.seq, tt.peer, time.Millisecond); got != tt.want {
+			t.Errorf("%s: reply(%d, %s) = %v, want %v", tt.name, tt.seq, tt.peer, got, tt.want)
+		}
+	}
+
+	results := st.results()
+	slices.SortFunc(results, func(x, y PingResult) int { return netip.MustParseAddr(x.IP).Compare(netip.MustParseAddr(y.IP)) })
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want 2 hosts", results)
+	}
+	// failed send is not counted
+	if r := results[0]; r.IP != "192.168.2.10" || r.Sent != 2 || r.Recv != 2 || r.Loss != 0 {
+		t.Errorf("result of %s = %+v, want 2 sent, 2 received", a, r)
+	}
+	if r := results[1]; r.IP != "192.168.2.11" || r.Sent != 1 || r.Recv != 1 {
+		t.Errorf("result of %s = %+v, want 1 sent, 1 received", b, r)
+	}
+}
+
+func TestSweepResult(t *testing.T) {
+	res := sweepResult("10.0.0.1", 4, &sweepStats{recv: 2, rtts: []time.Duration{10 * time.Millisecond, 30 * time.Millisecond}})
+	want := PingResult{IP: "10.0.0.1", Alive: true, Method: LivenessICMP, Sent: 4, Recv: 2, Loss: 50,
+		MinRTT: 10 * time.Millisecond, AvgRTT: 20 * time.Millisecond, MaxRTT: 30 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	if res != want {
+		t.Errorf("sweepResult = %+v, want %+v", res, want)
+	}
+}
+
+func TestSweeperParseReply(t *testing.T) {
+	s := &Sweeper{Privileged: true, id: 0x1234}
+	sc := &sweepConn{proto: 1, echo: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	payload := func(magic []byte) []byte {
+		b := append(slices.Clone(magic), make([]byte, 8)...)
+		binary.BigEndian.PutUint64(b[len(magic):], uint64(time.Now().Add(-5*time.Millisecond).UnixNano()))
+		return b
+	}
+	marshal := func(typ icmp.Type, id, seq int, data []byte) []byte {
+		b, err := (&icmp.Message{Type: typ, Body: &icmp.Echo{ID: id, Seq: seq, Data: data}}).Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{name: "reply", b: marshal(ipv4.ICMPTypeEchoReply, 0x1234, 7, payload(sweepMagic)), ok: true},
+		{name: "request", b: marshal(ipv4.ICMPTypeEcho, 0x1234, 7, payload(sweepMagic))},
+		{name: "other identifier", b: marshal(ipv4.ICMPTypeEchoReply, 0x4321, 7, payload(sweepMagic))},
+		{name: "foreign payload", b: marshal(ipv4.ICMPTypeEchoReply, 0x1234, 7, payload([]byte("ping-util")))},
+		{name: "short payload", b: marshal(ipv4.ICMPTypeEchoReply, 0x1234, 7, sweepMagic)},
+		{name: "garbage", b: []byte{0, 0}},
+	}
+	for _, tt := range tests {
+		seq, rtt, ok := s.parseReply(sc, tt.b)
+		if ok != tt.ok {
+			t.Errorf("%s: parseReply ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && (seq != 7 || rtt < 5*time.Millisecond) {
+			t.Errorf("%s: parseReply = %d, %v, want 7, >= 5ms", tt.name, seq, rtt)
+		}
+	}
+}
+
+func TestSweepLoopback(t *testing.T) {
+	s := NewSweeper(PingOptions{Privileged: true, Count: 2, Timeout: 200 * time.Millisecond}, 0)
+	sc, err := s.listen(false)
+	if err != nil {
+		t.Skipf("raw icmp socket is not permitted: %v", err)
+	}
+	sc.conn.Close()
+	results, err := s.Sweep(context.Background(), slices.Values([]string{"127.0.0.1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].IP != "127.0.0.1" || results[0].Sent != 2 || results[0].Recv != 2 {
+		t.Errorf("Sweep = %+v, want 2 replies from 127.0.0.1", results)
+	}
+}
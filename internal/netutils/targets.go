@@ -0,0 +1,179 @@
+package netutils
+
+import (
+	"fmt"
+	"iter"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// addrRange is an inclusive range of addresses of the same family
+type addrRange struct {
+	first netip.Addr
+	last  netip.Addr
+}
+
+// TargetSet is a de-duplicated set of addresses to scan
+type TargetSet struct {
+	ranges []addrRange
+}
+
+// ParseTargets builds target set from include specs without addresses from exclude specs.
+// Spec is a CIDR (192.168.1.0/24), a dash range (192.168.1.10-192.168.1.50) or a single address
+// Network and broadcast addresses are skipped for IPv4 prefixes up to /30,
+// /31 (RFC 3021) and /32 yield all their addresses, IPv6 prefixes yield every address
+func ParseTargets(include, exclude []string) (*TargetSet, error) {
+	inc, err := parseRanges(include)
+	if err != nil {
+		return nil, err
+	}
+	exc, err := parseRanges(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &TargetSet{ranges: subtractRanges(mergeRanges(inc), mergeRanges(exc))}, nil
+}
+
+// All returns lazy sequence of set addresses
+func (t *TargetSet) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, r := range t.ranges {
+			for ip := r.first; ip.IsValid(); ip = ip.Next() {
+				if !yield(ip.String()) {
+					return
+				}
+				if ip == r.last {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Contains reports whether ip is in set
+func (t *TargetSet) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, r := range t.ranges {
+		if addr.BitLen() == r.first.BitLen() && !addr.Less(r.first) && !r.last.Less(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRanges(specs []string) ([]addrRange, error) {
+	var ranges []addrRange
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		r, ok, err := parseRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges, nil
+}
+
+// parseRange returns ok=false for prefixes without host addresses
+func parseRange(spec string) (addrRange, bool, error) {
+	switch {
+	case strings.Contains(spec, "/"):
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return addrRange{}, false, fmt.Errorf("unable to parse cidr format for %s, %w", spec, err)
+		}
+		prefix = prefix.Masked()
+		r := addrRange{first: prefix.Addr(), last: lastAddr(prefix)}
+		if r.first.Is4() && prefix.Bits() <= 30 {
+			r.first, r.last = r.first.Next(), r.last.Prev()
+		}
+		return r, true, nil
+	case strings.Contains(spec, "-"):
+		from, to, _ := strings.Cut(spec, "-")
+		first, err := netip.ParseAddr(strings.TrimSpace(from))
+		if err != nil {
+			return addrRange{}, false, fmt.Errorf("unable to parse range %s, %w", spec, err)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(to))
+		if err != nil {
+			return addrRange{}, false, fmt.Errorf("unable to parse range %s, %w", spec, err)
+		}
+		if first.BitLen() != last.BitLen() || last.Less(first) {
+			return addrRange{}, false, fmt.Errorf("invalid range %s", spec)
+		}
+		return addrRange{first: first, last: last}, true, nil
+	default:
+		ip, err := netip.ParseAddr(spec)
+		if err != nil {
+			return addrRange{}, false, fmt.Errorf("unable to parse address %s, %w", spec, err)
+		}
+		return addrRange{first: ip, last: ip}, true, nil
+	}
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last, _ := netip.AddrFromSlice(b)
+	return last
+}
+
+// mergeRanges sorts ranges and joins overlapping and adjacent ones
+func mergeRanges(ranges []addrRange) []addrRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].first.Less(ranges[j].first)
+	})
+	var merged []addrRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			cur := &merged[n-1]
+			// Next of the last address of family is invalid, nothing can follow it
+			if cur.last.BitLen() == r.first.BitLen() && (!cur.last.Less(r.first) || cur.last.Next() == r.first) {
+				if cur.last.Less(r.last) {
+					cur.last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRanges removes exc addresses from inc, both must be merged
+func subtractRanges(inc, exc []addrRange) []addrRange {
+	var res []addrRange
+	for _, r := range inc {
+		cur := r
+		empty := false
+		for _, e := range exc {
+			if e.first.BitLen() != cur.first.BitLen() || e.last.Less(cur.first) || cur.last.Less(e.first) {
+				continue
+			}
+			if cur.first.Less(e.first) {
+				res = append(res, addrRange{first: cur.first, last: e.first.Prev()})
+			}
+			if !e.last.Less(cur.last) {
+				empty = true
+				break
+			}
+			cur.first = e.last.Next()
+		}
+		if !empty {
+			res = append(res, cur)
+		}
+	}
+	return res
+}
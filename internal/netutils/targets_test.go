@@ -0,0 +1,118 @@
+package netutils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{name: "cidr skips network and broadcast",
+			include: []string{"192.168.2.0/30"},
+			want:    []string{"192.168.2.1", "192.168.2.2"}},
+		{name: "cidr /31 yields both addresses",
+			include: []string{"10.0.0.0/31"},
+			want:    []string{"10.0.0.0", "10.0.0.1"}},
+		{name: "cidr /32 and single address",
+			include: []string{"10.0.0.5/32", "10.0.0.7"},
+			want:    []string{"10.0.0.5", "10.0.0.7"}},
+		{name: "cidr is masked",
+			include: []string{"192.168.2.77/30"},
+			want:    []string{"192.168.2.77", "192.168.2.78"}},
+		{name: "range",
+			include: []string{"192.168.1.10-192.168.1.12"},
+			want:    []string{"192.168.1.10", "192.168.1.11", "192.168.1.12"}},
+		{name: "range with spaces",
+			include: []string{" 192.168.1.10 - 192.168.1.11 "},
+			want:    []string{"192.168.1.10", "192.168.1.11"}},
+		{name: "ipv6 prefix yields every address",
+			include: []string{"2001:db8::/126"},
+			want:    []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{name: "ipv6 range",
+			include: []string{"2001:db8::fe-2001:db8::101"},
+			want:    []string{"2001:db8::fe", "2001:db8::ff", "2001:db8::100", "2001:db8::101"}},
+		{name: "families are kept apart",
+			include: []string{"2001:db8::1", "10.0.0.1"},
+			want:    []string{"10.0.0.1", "2001:db8::1"}},
+		{name: "overlaps and duplicates are merged",
+			include: []string{"10.0.0.3-10.0.0.5", "10.0.0.1-10.0.0.4", "10.0.0.4", "10.0.0.6"},
+			want:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}},
+		{name: "overlaps at the end of address space",
+			include: []string{"255.255.255.250-255.255.255.255", "255.255.255.252-255.255.255.255", "255.255.255.255"},
+			want: []string{"255.255.255.250", "255.255.255.251", "255.255.255.252",
+				"255.255.255.253", "255.255.255.254", "255.255.255.255"}},
+		{name: "overlaps at the end of ipv6 address space",
+			include: []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+			want:    []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}},
+		{name: "exclusions",
+			include: []string{"192.168.2.0/29"},
+			exclude: []string{"192.168.2.1", "192.168.2.4-192.168.2.5", "192.168.3.0/24"},
+			want:    []string{"192.168.2.2", "192.168.2.3", "192.168.2.6"}},
+		{name: "exclusion covers everything",
+			include: []string{"192.168.2.10-192.168.2.20"},
+			exclude: []string{"192.168.2.0/24"}},
+		{name: "exclusion at the end of address space",
+			include: []string{"255.255.255.253-255.255.255.255"},
+			exclude: []string{"255.255.255.255"},
+			want:    []string{"255.255.255.253", "255.255.255.254"}},
+		{name: "empty specs are skipped",
+			include: []string{"", " ", "10.0.0.1"},
+			want:    []string{"10.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := ParseTargets(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := slices.Collect(ts.All()); !slices.Equal(got, tt.want) {
+				t.Errorf("addresses = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTargetsErrors(t *testing.T) {
+	for _, spec := range []string{
+		"192.168.2.0/33",
+		"192.168.2.300",
+		"192.168.2.20-192.168.2.10",
+		"192.168.2.1-2001:db8::1",
+		"192.168.2.1-host",
+		"host.example.test",
+	} {
+		if _, err := ParseTargets([]string{spec}, nil); err == nil {
+			t.Errorf("ParseTargets(%q) succeeded, want error", spec)
+		}
+		if _, err := ParseTargets([]string{"10.0.0.1"}, []string{spec}); err == nil {
+			t.Errorf("ParseTargets with exclude %q succeeded, want error", spec)
+		}
+	}
+}
+
+func TestTargetSetContains(t *testing.T) {
+	ts, err := ParseTargets([]string{"192.168.2.0/24", "2001:db8::/64"}, []string{"192.168.2.100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"192.168.2.1":        true,
+		"192.168.2.0":        false,
+		"192.168.2.100":      false,
+		"192.168.3.1":        false,
+		"::ffff:192.168.2.1": true,
+		"2001:db8::abcd":     true,
+		"2001:db9::1":        false,
+		"not an ip":          false,
+	}
+	for ip, want := range tests {
+		if got := ts.Contains(ip); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
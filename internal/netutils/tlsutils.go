@@ -0,0 +1,167 @@
+package netutils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// tlsTimeout is a handshake timeout of TLS detection
+const tlsTimeout = 2 * time.Second
+
+// Certificate is a leaf certificate presented by TLS service
+type Certificate struct {
+	Subject    string
+	Issuer     string
+	SANs       []string
+	NotBefore  time.Time
+	NotAfter   time.Time
+	SelfSigned bool
+	// Version is negotiated TLS version
+	Version string
+}
+
+// Expired returns true if certificate is not valid at t
+func (c *Certificate) Expired(t time.Time) bool {
+	return t.After(c.NotAfter) || t.Before(c.NotBefore)
+}
+
+// Meta returns certificate attributes for consul meta, long names are truncated
+func (c *Certificate) Meta() map[string]string {
+	return map[string]string{
+		"tls_version":   c.Version,
+		"tls_subject":   truncate(c.Subject, metaValueLen),
+		"tls_issuer":    truncate(c.Issuer, metaValueLen),
+		"tls_not_after": c.NotAfter.UTC().Format(time.RFC3339),
+	}
+}
+
+// DetectTLS tries TLS handshake on port and returns leaf certificate, certificate is
+// not verified, hostname is sent as SNI unless it is an ip. Return false if port does not speak TLS
+func DetectTLS(ctx context.Context, hostname, address string, port int) (*Certificate, bool) {
+	release, err := probeLimiter.Acquire(ctx, address, 1)
+	if err != nil {
+		return nil, false
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, tlsTimeout)
+	defer cancel()
+	cfg := &tls.Config{InsecureSkipVerify: true}
+	if net.ParseIP(hostname) == nil {
+		cfg.ServerName = hostname
+	}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{}, Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"function": "DetectTLS",
+			"address":  hostname + ":" + strconv.Itoa(port),
+		}).Debugln(err)
+		return nil, false
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, false
+	}
+	cert := newCertificate(state.PeerCertificates[0])
+	cert.Version = tls.VersionName(state.Version)
+	logger.WithFields(logger.Fields{
+		"function": "DetectTLS",
+		"address":  hostname + ":" + strconv.Itoa(port),
+	}).Debugf("TLS %s, subject %q, issuer %q, expires %v", cert.Version, cert.Subject, cert.Issuer, cert.NotAfter)
+	return cert, true
+}
+
+func newCertificate(leaf *x509.Certificate) *Certificate {
+	c := &Certificate{
+		Subject:    leaf.Subject.String(),
+		Issuer:     leaf.Issuer.String(),
+		SANs:       slices.Clone(leaf.DNSNames),
+		NotBefore:  leaf.NotBefore,
+		NotAfter:   leaf.NotAfter,
+		SelfSigned: leaf.CheckSignatureFrom(leaf) == nil,
+	}
+	for _, ip := range leaf.IPAddresses {
+		c.SANs = append(c.SANs, ip.String())
+	}
+	return c
+}
+
+// TLSEndpoint is a host port which presented certificate
+type TLSEndpoint struct {
+	Hostname string
+	IP       string
+	Port     int
+	Cert     *Certificate
+}
+
+// Target returns endpoint as host:port, host name is preferred for SNI
+func (e TLSEndpoint) Target() string {
+	host := e.Hostname
+	if host == "" {
+		host = e.IP
+	}
+	return net.JoinHostPort(host, strconv.Itoa(e.Port))
+}
+
+// WriteCertReport writes certificates sorted by expiry date, certificates
+// expiring within warn are marked EXPIRING
+func WriteCertReport(w io.Writer, endpoints []TLSEndpoint, warn time.Duration) error {
+	sorted := slices.Clone(endpoints)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Cert.NotAfter.Before(sorted[j].Cert.NotAfter)
+	})
+	now := time.Now()
+	for _, e := range sorted {
+		status := "OK"
+		switch {
+		case e.Cert.Expired(now):
+			status = "EXPIRED"
+		case e.Cert.NotAfter.Before(now.Add(warn)):
+			status = "EXPIRING"
+		}
+		days := int(e.Cert.NotAfter.Sub(now).Hours() / 24)
+		_, err := fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", status, days,
+			e.Cert.NotAfter.UTC().Format(time.DateOnly), e.Target(), e.IP, e.Cert.Subject, e.Cert.Issuer,
+			strings.Join(e.Cert.SANs, ","))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSSLExporterTargets writes endpoints as prometheus file_sd targets for ssl_exporter
+func WriteSSLExporterTargets(w io.Writer, endpoints []TLSEndpoint) error {
+	type target struct {
+		Targets []string          `json:"targets"`
+		Labels  map[string]string `json:"labels"`
+	}
+	targets := make([]target, 0, len(endpoints))
+	for _, e := range endpoints {
+		targets = append(targets, target{
+			Targets: []string{e.Target()},
+			Labels: map[string]string{
+				"ip":      e.IP,
+				"subject": e.Cert.Subject,
+			},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(targets)
+}
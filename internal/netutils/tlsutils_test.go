@@ -0,0 +1,64 @@
+package netutils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertificateMeta(t *testing.T) {
+	cert := &Certificate{
+		Subject:  "CN=" + strings.Repeat("устройство", 30),
+		Issuer:   "CN=" + strings.Repeat("a", 300),
+		NotAfter: time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("MSK", 3*60*60)),
+		Version:  "TLS 1.3",
+	}
+	meta := cert.Meta()
+	if len(meta["tls_subject"]) > metaValueLen || !strings.HasPrefix(cert.Subject, meta["tls_subject"]) {
+		t.Errorf("tls_subject of %d bytes = %q", len(meta["tls_subject"]), meta["tls_subject"])
+	}
+	if len(meta["tls_issuer"]) != metaValueLen {
+		t.Errorf("tls_issuer has %d bytes, want %d", len(meta["tls_issuer"]), metaValueLen)
+	}
+	if meta["tls_not_after"] != "2030-01-02T00:04:05Z" || meta["tls_version"] != "TLS 1.3" {
+		t.Errorf("meta = %v", meta)
+	}
+
+	short := (&Certificate{Subject: "CN=nas.hm.net", Issuer: "CN=nas.hm.net"}).Meta()
+	if short["tls_subject"] != "CN=nas.hm.net" || short["tls_issuer"] != "CN=nas.hm.net" {
+		t.Errorf("meta = %v", short)
+	}
+}
+
+func TestDetectTLS(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	plainSrv := httptest.NewServer(handler)
+	defer plainSrv.Close()
+
+	p := testHTTPProbe(t, tlsSrv)
+	cert, ok := DetectTLS(context.Background(), p.Hostname, p.IP, p.Port)
+	if !ok {
+		t.Fatal("TLS is not detected")
+	}
+	leaf := tlsSrv.Certificate()
+	if cert.Subject != leaf.Subject.String() || cert.Issuer != leaf.Issuer.String() || !cert.NotAfter.Equal(leaf.NotAfter) {
+		t.Errorf("certificate = %+v", cert)
+	}
+	if !slices.Contains(cert.SANs, "example.com") || !slices.Contains(cert.SANs, "127.0.0.1") {
+		t.Errorf("SANs = %v", cert.SANs)
+	}
+	if cert.Version == "" || cert.Expired(time.Now()) {
+		t.Errorf("certificate = %+v", cert)
+	}
+
+	p = testHTTPProbe(t, plainSrv)
+	if cert, ok := DetectTLS(context.Background(), p.Hostname, p.IP, p.Port); ok {
+		t.Errorf("TLS is detected on plain http port: %+v", cert)
+	}
+}
@@ -0,0 +1,229 @@
+package netutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	logger "github.com/sirupsen/logrus"
+)
+
+// udpService is a request payload of udp protocol and a check of its response
+type udpService struct {
+	name    string
+	request func(id uint16) []byte
+	match   func(id uint16, resp []byte) bool
+}
+
+// udpServices are udp protocols probed by well known port,
+// udp services do not answer to unknown payloads
+var udpServices = map[int]udpService{
+	53:    {name: "dns", request: dnsRequest(".", dns.TypeNS), match: dnsResponse},
+	161:   {name: "snmp", request: snmpRequest, match: snmpResponse},
+	5353:  {name: "mdns", request: dnsRequest(mdnsServicesQuery, dns.TypePTR), match: dnsResponse},
+	5683:  {name: "coap", request: coapRequest, match: coapResponse},
+	54321: {name: "miio", request: miioRequest, match: miioResponse},
+}
+
+// UDPPorts returns ports with known udp probe payloads
+func UDPPorts() []int {
+	ports := make([]int, 0, len(udpServices))
+	for port := range udpServices {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// UDPProber sends protocol request to udp port, port is open and service is
+// detected (dns, snmp, mdns, coap, miio) if response matches the protocol
+type UDPProber struct{}
+
+// Probe implements Prober
+func (UDPProber) Probe(ctx context.Context, p PortProbe) ProbeResult {
+	res := ProbeResult{PortProbe: p}
+	svc, ok := udpServices[p.Port]
+	if !ok {
+		res.Err = fmt.Errorf("no probe payload for udp port %d", p.Port)
+		return res
+	}
+	release, err := probeLimiter.Acquire(ctx, p.IP, 1)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(p.IP, strconv.Itoa(p.Port)))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	// positive two byte request id keeps snmp integer encoding minimal
+	id := uint16(0x80 + rand.N(0x8000-0x80))
+	buf := make([]byte, 4096)
+	start := time.Now()
+	if _, err = conn.Write(svc.request(id)); err == nil {
+		// skip stray datagrams until matching response or timeout
+		for {
+			var n int
+			if n, err = conn.Read(buf); err != nil {
+				break
+			}
+			if svc.match(id, buf[:n]) {
+				res.Open = true
+				res.Latency = time.Since(start)
+				break
+			}
+		}
+	}
+	if !res.Open {
+		logger.WithFields(logger.Fields{
+			"function": "UDPProber.Probe",
+			"address":  p.Hostname + ":" + strconv.Itoa(p.Port),
+		}).Debugln(err)
+		res.Err = err
+		return res
+	}
+
+	res.Service, res.Evidence = svc.name, svc.name+" response"
+	logger.WithFields(logger.Fields{
+		"function": "UDPProber.Probe",
+		"service":  svc.name,
+	}).Infof("Service %s was found on %s:%d/udp\n", svc.name, p.Hostname, p.Port)
+	return res
+}
+
+func dnsRequest(name string, qtype uint16) func(id uint16) []byte {
+	return func(id uint16) []byte {
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		m.Id = id
+		b, _ := m.Pack()
+		return b
+	}
+}
+
+func dnsResponse(id uint16, resp []byte) bool {
+	m := new(dns.Msg)
+	if err := m.Unpack(resp); err != nil {
+		return false
+	}
+	// mdns responders answer with zero id
+	return m.Response && (m.Id == id || m.Id == 0)
+}
+
+// snmpRequest is SNMPv2c get-request of sysDescr.0 with community public
+func snmpRequest(id uint16) []byte {
+	oid := []byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00}
+	varbind := tlv(0x30, append(oid, 0x05, 0x00))
+	pdu := tlv(0xa0, bytes.Join([][]byte{
+		{0x02, 0x02, byte(id >> 8), byte(id)}, // request-id
+		{0x02, 0x01, 0x00},                    // error-status
+		{0x02, 0x01, 0x00},                    // error-index
+		tlv(0x30, varbind),
+	}, nil))
+	return tlv(0x30, bytes.Join([][]byte{
+		{0x02, 0x01, 0x01}, // version 2c
+		tlv(0x04, []byte("public")),
+		pdu,
+	}, nil))
+}
+
+// snmpResponse checks message with get-response pdu of our request id
+func snmpResponse(id uint16, resp []byte) bool {
+	msg, _, ok := berElement(resp, 0x30)
+	if !ok {
+		return false
+	}
+	// version and community precede pdu
+	for _, tag := range []byte{0x02, 0x04} {
+		if _, msg, ok = berElement(msg, tag); !ok {
+			return false
+		}
+	}
+	pdu, _, ok := berElement(msg, 0xa2)
+	if !ok {
+		return false
+	}
+	reqID, _, ok := berElement(pdu, 0x02)
+	if !ok || len(reqID) == 0 || len(reqID) > 4 {
+		return false
+	}
+	var n uint32
+	for _, c := range reqID {
+		n = n<<8 | uint32(c)
+	}
+	return n == uint32(id)
+}
+
+// berElement returns value of BER element with tag at start of b and the rest of b,
+// definite lengths up to two bytes are supported
+func berElement(b []byte, tag byte) (value, rest []byte, ok bool) {
+	if len(b) < 2 || b[0] != tag {
+		return nil, nil, false
+	}
+	n, b := int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 2 || len(b) < size {
+			return nil, nil, false
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < n {
+		return nil, nil, false
+	}
+	return b[:n], b[n:], true
+}
+
+// tlv encodes short BER element
+func tlv(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value))}, value...)
+}
+
+// coapRequest is confirmable GET /.well-known/core
+func coapRequest(id uint16) []byte {
+	b := []byte{0x40, 0x01, byte(id >> 8), byte(id)}
+	b = append(b, 0xbb) // option Uri-Path, length 11
+	b = append(b, ".well-known"...)
+	b = append(b, 0x04) // option Uri-Path, length 4
+	return append(b, "core"...)
+}
+
+func coapResponse(id uint16, resp []byte) bool {
+	// version 1, acknowledgement or reset for our message id
+	if len(resp) < 4 || resp[0]>>6 != 1 || resp[0]>>4&0x03 < 2 {
+		return false
+	}
+	return binary.BigEndian.Uint16(resp[2:4]) == id
+}
+
+// miioRequest is Xiaomi miIO hello packet
+func miioRequest(_ uint16) []byte {
+	b := bytes.Repeat([]byte{0xff}, 32)
+	copy(b, []byte{0x21, 0x31, 0x00, 0x20})
+	return b
+}
+
+func miioResponse(_ uint16, resp []byte) bool {
+	return len(resp) >= 32 && resp[0] == 0x21 && resp[1] == 0x31
+}
@@ -0,0 +1,129 @@
+package netutils
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const testProbeID = 0x1234
+
+func testDNSMsg(t *testing.T, id uint16, response bool) []byte {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeNS)
+	m.Id, m.Response = id, response
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testSNMPMsg builds SNMPv2c message with pdu of tag and request id encoded in reqID bytes
+func testSNMPMsg(pduTag byte, reqID ...byte) []byte {
+	pdu := tlv(pduTag, bytes.Join([][]byte{
+		tlv(0x02, reqID),
+		{0x02, 0x01, 0x00},
+		{0x02, 0x01, 0x00},
+		tlv(0x30, tlv(0x30, []byte{0x06, 0x01, 0x00, 0x04, 0x03, 'n', 'a', 's'})),
+	}, nil))
+	return tlv(0x30, bytes.Join([][]byte{{0x02, 0x01, 0x01}, tlv(0x04, []byte("public")), pdu}, nil))
+}
+
+func testMiioHello() []byte {
+	b := make([]byte, 32)
+	copy(b, []byte{0x21, 0x31, 0x00, 0x20})
+	return b
+}
+
+func TestUDPResponses(t *testing.T) {
+	// snmp message with long form length of sequence
+	long := testSNMPMsg(0xa2, 0x12, 0x34)
+	long = append([]byte{0x30, 0x81, long[1]}, long[2:]...)
+
+	tests := []struct {
+		name string
+		port int
+		resp []byte
+		want bool
+	}{
+		{"dns response", 53, testDNSMsg(t, testProbeID, true), true},
+		{"dns response to other id", 53, testDNSMsg(t, 0x4321, true), false},
+		{"dns query", 53, testDNSMsg(t, testProbeID, false), false},
+		{"dns garbage", 53, []byte{0x12, 0x34, 0x80}, false},
+		{"mdns response with zero id", 5353, testDNSMsg(t, 0, true), true},
+
+		{"snmp get-response", 161, testSNMPMsg(0xa2, 0x12, 0x34), true},
+		{"snmp get-response with long length", 161, long, true},
+		{"snmp get-response with padded id", 161, testSNMPMsg(0xa2, 0x00, 0x00, 0x12, 0x34), true},
+		{"snmp get-response to other id", 161, testSNMPMsg(0xa2, 0x43, 0x21), false},
+		{"snmp get-request", 161, testSNMPMsg(0xa0, 0x12, 0x34), false},
+		{"snmp echo of request", 161, snmpRequest(testProbeID), false},
+		{"snmp truncated", 161, testSNMPMsg(0xa2, 0x12, 0x34)[:20], false},
+		{"snmp response tag in other payload", 161, []byte{0x30, 0x04, 0x04, 0x02, 0xa2, 0x00}, false},
+
+		{"coap acknowledgement", 5683, []byte{0x60, 0x45, 0x12, 0x34, 0xff}, true},
+		{"coap reset", 5683, []byte{0x70, 0x00, 0x12, 0x34}, true},
+		{"coap acknowledgement of other id", 5683, []byte{0x60, 0x45, 0x43, 0x21}, false},
+		{"coap echo of request", 5683, coapRequest(testProbeID), false},
+		{"coap wrong version", 5683, []byte{0xa0, 0x45, 0x12, 0x34}, false},
+		{"coap short", 5683, []byte{0x60, 0x45, 0x12}, false},
+
+		{"miio hello", 54321, testMiioHello(), true},
+		{"miio short", 54321, testMiioHello()[:16], false},
+		{"miio wrong magic", 54321, append([]byte{0x21, 0x32}, testMiioHello()[2:]...), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := udpServices[tt.port].match(testProbeID, tt.resp); got != tt.want {
+				t.Errorf("%s match = %v, want %v", udpServices[tt.port].name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUDPRequests(t *testing.T) {
+	for _, port := range []int{53, 5353} {
+		m := new(dns.Msg)
+		if err := m.Unpack(udpServices[port].request(testProbeID)); err != nil {
+			t.Fatalf("%s request: %v", udpServices[port].name, err)
+		}
+		if m.Id != testProbeID || m.Response || len(m.Question) != 1 {
+			t.Errorf("%s request = %v", udpServices[port].name, m)
+		}
+	}
+
+	msg, rest, ok := berElement(snmpRequest(testProbeID), 0x30)
+	if !ok || len(rest) != 0 {
+		t.Fatalf("snmp request is not a sequence")
+	}
+	for _, tag := range []byte{0x02, 0x04} {
+		if _, msg, ok = berElement(msg, tag); !ok {
+			t.Fatalf("snmp request has no element %#x", tag)
+		}
+	}
+	pdu, _, ok := berElement(msg, 0xa0)
+	if !ok {
+		t.Fatal("snmp request has no get-request pdu")
+	}
+	if reqID, _, _ := berElement(pdu, 0x02); !bytes.Equal(reqID, []byte{0x12, 0x34}) {
+		t.Errorf("snmp request id = %x, want 1234", reqID)
+	}
+
+	if coap := coapRequest(testProbeID); !bytes.Equal(coap[:4], []byte{0x40, 0x01, 0x12, 0x34}) ||
+		!bytes.HasSuffix(coap, []byte("\x04core")) {
+		t.Errorf("coap request = %x", coap)
+	}
+	if hello := miioRequest(testProbeID); len(hello) != 32 || !miioResponse(testProbeID, hello) {
+		t.Errorf("miio request = %x", hello)
+	}
+}
+
+func TestUDPPorts(t *testing.T) {
+	if got, want := UDPPorts(), []int{53, 161, 5353, 5683, 54321}; !slices.Equal(got, want) {
+		t.Errorf("UDPPorts = %v, want %v", got, want)
+	}
+}
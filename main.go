@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	logger "github.com/sirupsen/logrus"
 	"github.com/valeyard77/consul_host_discover/internal/netutils"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -14,35 +18,101 @@ const (
 	Datacenter             = "ex"
 	DeregisterServiceTime  = "48h"
 	FailuresBeforeCritical = 3
+	DNSServer              = ""
+	DNSPort                = 53
+	InventoryFile          = "" // static inventory [yaml/csv/hosts], disabled if empty
+	DHCPLeasesFormat       = "" // dnsmasq or isc, detected by content if empty
+	MDNSBrowse             = false
+	MDNSTimeout            = 3 * time.Second
+	RatePPS                = 200 // packets per second for all probes, unlimited if 0
+	RatePerHost            = 4   // concurrent probes per host, unlimited if 0
+	ScanTimeout            = 0   // overall scan time budget, unlimited if 0
+	Threads                = 14  // concurrent host and port probes
+	ScanProfile            = netutils.ProfileQuick
+	ScanProfilesFile       = ""   // yaml file with extra scan profiles, disabled if empty
+	GrabBanners            = true // identify services on open tcp ports by banners
+	DetectTLS              = true // collect certificates, http ports speaking TLS are checked over https
+	CertExpiryWarn         = 30 * 24 * time.Hour
+	SSLExporterTargetsFile = "" // prometheus file_sd targets for ssl_exporter, disabled if empty
+	FingerprintsFile       = "" // yaml file with http fingerprint rules, disabled if empty
+	ServicesFile           = "" // service names overrides in /etc/services format, disabled if empty
 )
 
+// scan profiles by host group, other groups use ScanProfile
+var groupProfiles = []string{"ipcam:iot", "light:iot", "sockets:iot", "vacuum:iot"}
+
+// rate limit overrides, cheap IoT sockets crash under bursts
+var rateGroups = map[string]netutils.GroupLimit{
+	"sockets": {PPS: 5, PerHost: 1},
+}
+
+// dhcp lease files or http(s) urls
+var dhcpLeases = []string{}
+
+// zones for discovery, empty Server means nameserver from /etc/resolv.conf
+var dnsZones = []netutils.DNSZone{
+	{Name: "hm.net", Server: DNSServer, Port: DNSPort},
+	{Name: "dev.hm.net", Server: DNSServer, Port: DNSPort},
+	{Name: "0.168.192.in-addr.arpa", Server: DNSServer, Port: DNSPort},
+	{Name: "1.168.192.in-addr.arpa", Server: DNSServer, Port: DNSPort},
+}
+
 type consulHostSvc struct {
 	Svc struct {
 		HOSTNAME string `json:"HOSTNAME"`
 		IP       string `json:"IP"`
+		ZONE     string `json:"ZONE"`
+		MAC      string `json:"MAC"`
+		LIVENESS string `json:"LIVENESS"`
+		PING     struct {
+			Loss   float64           `json:"Loss"`
+			MinRTT float64           `json:"MinRTT"`
+			AvgRTT float64           `json:"AvgRTT"`
+			MaxRTT float64           `json:"MaxRTT"`
+			Jitter float64           `json:"Jitter"`
+			Meta   map[string]string `json:"-"`
+		} `json:"PING"`
+		GROUP    string            `json:"GROUP"`
+		LOCATION string            `json:"LOCATION"`
+		META     map[string]string `json:"META"`
 		TCPCheck struct {
-			Ports []int `json:"Ports"`
+			Ports    []int          `json:"Ports"`
+			Services map[int]string `json:"Services"`
+			Banners  map[int]string `json:"Banners"`
 		} `json:"TCPCheck"`
 		HTTP struct {
 			Ports []int `json:"Ports"`
 		} `json:"HTTP"`
-		Exporters [1]struct {
-			NodeExporter    int `json:"node_exporter"`
-			ProcessExporter int `json:"process_exporter"`
-			ConsulExporter  int `json:"consul_exporter"`
-			SslExporter     int `json:"ssl_exporter"`
-			RabbitMQ        int `json:"rabbitMQ"`
-			VictoriaMetrics int `json:"victoriametrics"`
-		} `json:"Exporters"`
-		RabbitMQ struct {
+		HTTPS struct {
+			Ports []int `json:"Ports"`
+		} `json:"HTTPS"`
+		UDPCheck struct {
+			Ports []int `json:"Ports"`
+		} `json:"UDPCheck"`
+		TLS          map[int]*netutils.Certificate `json:"TLS"`
+		FINGERPRINTS map[int]fingerprint           `json:"FINGERPRINTS"`
+		HTTPINFO     map[int]*netutils.HTTPInfo    `json:"HTTPINFO"`
+		Exporters    []exporter                    `json:"Exporters"`
+		RabbitMQ     struct {
 			Port int `json:"Port"`
 		} `json:"RabbitMQ"`
 	} `json:"Svc"`
 }
 
-type hosts struct {
-	tcpPorts  []int
-	httpPorts []int
+// exporter is a prometheus exporter found on host, one per port
+type exporter struct {
+	Name    string `json:"Name"`
+	Port    int    `json:"Port"`
+	Path    string `json:"Path"`
+	Scheme  string `json:"Scheme"`
+	Version string `json:"Version"`
+}
+
+// fingerprint is a service recognized on http port
+type fingerprint struct {
+	Service string   `json:"Service"`
+	Version string   `json:"Version"`
+	Tags    []string `json:"Tags"`
 }
 
 func init() {
@@ -61,88 +131,304 @@ func init() {
 	logger.SetLevel(logger.InfoLevel)
 }
 
-func setConsulCheckParams(dns_zone map[string]string) *[]consulHostSvc {
-	ch := make(chan map[string]bool, 4)
+// hostCheck is a host with its liveness result
+type hostCheck struct {
+	host     netutils.Host
+	hostname string
+	group    string
+	ping     netutils.PingResult
+	mac      string
+	liveness string
+	alive    bool
+}
+
+func setConsulCheckParams(ctx context.Context, hostList []netutils.Host) *[]consulHostSvc {
 	l := []consulHostSvc{}
 
-	/*
-		    6379 - redis
-			9100, 9200 - node_exporter
-			9256 - process_exporter
-			9219 - ssl_exporter
-			9107 - consul_exporter
-		    8428 - victoriametrics
-			15672 - rabbitMQ /api/metrics
-	*/
-	hp := hosts{
-		tcpPorts:  []int{21, 22, 1883, 3306, 5432, 6379},
-		httpPorts: []int{80, 9100, 9200, 8123, 3000, 9256, 9107, 8428},
-	}
-
-	//dns_zone = make(map[string]string)
-	//dns_zone["hc.hm.net"] = "192.168.1.4"
-	//dns_zone["printer-nkr.hm.net"] = "192.168.0.251"
-	//dns_zone["hc2.hm.net"] = "192.168.0.4"
-	//dns_zone["mpwr-kt200-sc3.dev.hm.net"] = "192.168.1.200"
-
-	for hostname, ip := range dns_zone {
-		alive := netutils.Ping(ip)
-		if alive == true {
-			logger.Infof("Host %s/%s is alive \n", hostname, ip)
-			var hsvc consulHostSvc
-
-			hsvc.Svc.HOSTNAME = hostname
-			hsvc.Svc.IP = ip
-			for _, port := range hp.tcpPorts {
-				go netutils.CheckTCPConnect(hostname, ip, port, ch)
-				st := <-ch
-				if st["tcp_check"] == true {
-					hsvc.Svc.TCPCheck.Ports = append(hsvc.Svc.TCPCheck.Ports, port)
-				}
-				//time.Sleep(100 * time.Millisecond)
+	profiles := netutils.NewScanProfiles()
+	profiles.Default = ScanProfile
+	profiles.GrabBanners = GrabBanners
+	profiles.DetectTLS = DetectTLS
+	if err := profiles.SetGroups(groupProfiles); err != nil {
+		logger.Fatalln(err)
+	}
+	if ScanProfilesFile != "" {
+		if err := profiles.LoadFile(ScanProfilesFile); err != nil {
+			logger.Fatalln(err)
+		}
+	}
+	if err := profiles.Validate(); err != nil {
+		logger.Fatalln(err)
+	}
+
+	limiter := netutils.NewRateLimiter(RatePPS, RatePerHost, rateGroups)
+	netutils.SetRateLimiter(limiter)
+
+	// ICMP-silent devices are alive if kernel has resolved their mac
+	neighbours, err := netutils.ReadNeighbours()
+	if err != nil {
+		logger.Warnln(err)
+	}
+
+	// check liveness of all hosts in a pool of Threads workers
+	checks := make([]hostCheck, len(hostList))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < Threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				checks[idx] = checkHost(ctx, hostList[idx], neighbours, limiter)
 			}
+		}()
+	}
+	probed := 0
+	for idx := range hostList {
+		// stop probing, already probed hosts are still registered
+		if ctx.Err() != nil {
+			logger.Warnf("Scan interrupted (%v), %d of %d hosts probed", ctx.Err(), probed, len(hostList))
+			break
+		}
+		jobs <- idx
+		probed++
+	}
+	close(jobs)
+	wg.Wait()
 
-			for _, port := range hp.httpPorts {
-				go netutils.CheckHTTPConnect(hostname, ip, port, "http", ch)
-				stmap := <-ch
-				if stmap["http_result"] == true {
-					hsvc.Svc.HTTP.Ports = append(hsvc.Svc.HTTP.Ports, port)
-				}
-				if stmap["node_exporter"] == true {
-					hsvc.Svc.Exporters[0].NodeExporter = port
-				}
-				if stmap["consul_exporter"] == true {
-					hsvc.Svc.Exporters[0].ConsulExporter = port
+	// scan ports of alive hosts concurrently
+	var probes []netutils.PortProbe
+	for _, c := range checks[:probed] {
+		if !c.alive {
+			logger.Infof("Host %s/%s is not alive\n", c.hostname, c.host.IP)
+			continue
+		}
+		logger.Infof("Host %s/%s is alive (%s)\n", c.hostname, c.host.IP, c.liveness)
+		host := c.host
+		host.Group = c.group
+		probes = append(probes, profiles.Probes(c.hostname, host)...)
+	}
+	results := netutils.ScanPorts(ctx, probes, Threads)
+	portResults := make(map[string][]netutils.ProbeResult)
+	for _, r := range results {
+		portResults[r.IP] = append(portResults[r.IP], r)
+	}
+	reportCertificates(netutils.TLSEndpoints(results))
+
+	for _, c := range checks[:probed] {
+		if !c.alive {
+			continue
+		}
+		host, hostname, ip := c.host, c.hostname, c.host.IP
+		var hsvc consulHostSvc
+
+		hsvc.Svc.HOSTNAME = hostname
+		hsvc.Svc.IP = ip
+		hsvc.Svc.ZONE = host.Zone
+		hsvc.Svc.MAC = c.mac
+		if c.mac == "" {
+			hsvc.Svc.MAC = host.MAC
+		}
+		hsvc.Svc.LIVENESS = c.liveness
+		if c.ping.Alive {
+			hsvc.Svc.PING.Loss = c.ping.Loss
+			hsvc.Svc.PING.MinRTT = c.ping.MinRTT.Seconds() * 1000
+			hsvc.Svc.PING.AvgRTT = c.ping.AvgRTT.Seconds() * 1000
+			hsvc.Svc.PING.MaxRTT = c.ping.MaxRTT.Seconds() * 1000
+			hsvc.Svc.PING.Jitter = c.ping.Jitter.Seconds() * 1000
+			hsvc.Svc.PING.Meta = c.ping.Meta()
+		}
+		hsvc.Svc.GROUP = host.Group
+		hsvc.Svc.LOCATION = host.Location
+		hsvc.Svc.META = host.Meta
+
+		for _, r := range portResults[ip] {
+			if !r.Open {
+				continue
+			}
+			port := r.Port
+			logger.Infof("Port %s:%d/%s is open (%s by %s), latency %v", hostname, port, r.Proto, r.Service, r.Evidence, r.Latency)
+			if r.TLS != nil {
+				if hsvc.Svc.TLS == nil {
+					hsvc.Svc.TLS = make(map[int]*netutils.Certificate)
 				}
-				if stmap["process_exporter"] == true {
-					hsvc.Svc.Exporters[0].ProcessExporter = port
+				hsvc.Svc.TLS[port] = r.TLS
+			}
+			switch {
+			case r.Exporter != "":
+				scheme := "http"
+				if r.TLS != nil {
+					scheme = "https"
 				}
-				if stmap["rabbitmq"] == true {
-					hsvc.Svc.Exporters[0].RabbitMQ = port
+				hsvc.Svc.Exporters = append(hsvc.Svc.Exporters, exporter{
+					Name:    r.Exporter,
+					Port:    port,
+					Path:    r.MetricsPath,
+					Scheme:  scheme,
+					Version: r.Version,
+				})
+			case r.Proto == netutils.ProtoTCP:
+				hsvc.Svc.TCPCheck.Ports = append(hsvc.Svc.TCPCheck.Ports, port)
+				if r.Service != "" {
+					if hsvc.Svc.TCPCheck.Services == nil {
+						hsvc.Svc.TCPCheck.Services = make(map[int]string)
+						hsvc.Svc.TCPCheck.Banners = make(map[int]string)
+					}
+					hsvc.Svc.TCPCheck.Services[port] = r.Service
 				}
-				if stmap["victoriametrics"] == true {
-					hsvc.Svc.Exporters[0].VictoriaMetrics = port
+				if r.Evidence == netutils.EvidenceBanner {
+					hsvc.Svc.TCPCheck.Banners[port] = r.Banner
 				}
+			case r.Proto == netutils.ProtoUDP:
+				hsvc.Svc.UDPCheck.Ports = append(hsvc.Svc.UDPCheck.Ports, port)
+			case r.TLS != nil:
+				hsvc.Svc.HTTPS.Ports = append(hsvc.Svc.HTTPS.Ports, port)
+				hsvc.setFingerprint(r, port)
+				hsvc.setHTTPInfo(r, port)
+			default:
+				hsvc.Svc.HTTP.Ports = append(hsvc.Svc.HTTP.Ports, port)
+				hsvc.setFingerprint(r, port)
+				hsvc.setHTTPInfo(r, port)
 			}
-			l = append(l, hsvc)
-		} else {
-			logger.Infof("Host %s/%s is not alive\n", hostname, ip)
 		}
+		l = append(l, hsvc)
 	}
-	defer close(ch)
 	return &l
 }
 
+// setFingerprint keeps service recognized on http port by fingerprint rules
+func (hsvc *consulHostSvc) setFingerprint(r netutils.ProbeResult, port int) {
+	if r.Evidence == netutils.EvidencePort {
+		return
+	}
+	if hsvc.Svc.FINGERPRINTS == nil {
+		hsvc.Svc.FINGERPRINTS = make(map[int]fingerprint)
+	}
+	hsvc.Svc.FINGERPRINTS[port] = fingerprint{Service: r.Service, Version: r.Version, Tags: r.Tags}
+}
+
+// setHTTPInfo keeps response metadata of http port
+func (hsvc *consulHostSvc) setHTTPInfo(r netutils.ProbeResult, port int) {
+	if r.HTTP == nil {
+		return
+	}
+	if hsvc.Svc.HTTPINFO == nil {
+		hsvc.Svc.HTTPINFO = make(map[int]*netutils.HTTPInfo)
+	}
+	hsvc.Svc.HTTPINFO[port] = r.HTTP
+}
+
+// reportCertificates warns about expiring certificates and writes ssl_exporter targets
+func reportCertificates(endpoints []netutils.TLSEndpoint) {
+	now := time.Now()
+	for _, e := range endpoints {
+		if e.Cert.Expired(now) {
+			logger.Warnf("Certificate of %s (%s) has expired %v", e.Target(), e.Cert.Subject, e.Cert.NotAfter)
+		} else if e.Cert.NotAfter.Before(now.Add(CertExpiryWarn)) {
+			logger.Warnf("Certificate of %s (%s) expires %v", e.Target(), e.Cert.Subject, e.Cert.NotAfter)
+		}
+	}
+	if SSLExporterTargetsFile == "" {
+		return
+	}
+	f, err := os.Create(SSLExporterTargetsFile)
+	if err != nil {
+		logger.Errorln(err)
+		return
+	}
+	defer f.Close()
+	if err = netutils.WriteSSLExporterTargets(f, endpoints); err != nil {
+		logger.Errorln(err)
+	}
+}
+
+// checkHost pings host and falls back to neighbour table for ICMP-silent devices
+func checkHost(ctx context.Context, host netutils.Host, neighbours map[string]string, limiter *netutils.RateLimiter) hostCheck {
+	c := hostCheck{host: host, hostname: host.Hostname}
+	if c.hostname == "" {
+		c.hostname = host.IP
+	}
+	c.group = host.Group
+	if c.group == "" {
+		c.group = netutils.DetectGroup(c.hostname)
+	}
+	limiter.SetHostGroup(host.IP, c.group)
+
+	c.ping = netutils.PingHost(ctx, host.IP, netutils.DefaultPingOptions())
+	c.alive = c.ping.Alive
+	c.liveness = c.ping.Method
+	mac, ok := neighbours[host.IP]
+	c.mac = mac
+	if ok && c.alive == false {
+		c.alive = true
+		c.liveness = netutils.LivenessARP
+		logger.Debugf("Host %s/%s found in neighbour table with mac %s", c.hostname, host.IP, mac)
+	}
+	return c
+}
+
 func main() {
 	start := time.Now().Unix()
-	fmt.Println("Get zone info from hm.net")
-	t := netutils.GetDNSZoneInfo("hm.net")
-	fmt.Printf("Recieved %d hosts from dns, let's deduplicate data in dns zone hm.net\n", len(t))
-	dns_zone := netutils.RemoveDuplicateIP(t)
-	fmt.Printf("Deduplicate complete, now is %d hosts in dns zone\n", len(dns_zone))
+
+	// stop new probes on SIGINT/SIGTERM, partial results are still registered
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	if ScanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ScanTimeout)
+		defer cancel()
+	}
+	// service names are needed by port specs of scan profiles
+	if err := netutils.LoadServices(ServicesFile); err != nil {
+		logger.Fatalln(err)
+	}
+	if FingerprintsFile != "" {
+		if err := netutils.LoadFingerprints(FingerprintsFile); err != nil {
+			logger.Fatalln(err)
+		}
+	}
+
+	inv := make(netutils.Inventory)
+	if InventoryFile != "" {
+		static, err := netutils.LoadInventoryFile(InventoryFile)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		fmt.Printf("Loaded %d hosts from inventory file %s\n", len(static), InventoryFile)
+		inv.Merge(static)
+	}
+
+	if len(dnsZones) > 0 {
+		fmt.Printf("Get zone info from %d zones\n", len(dnsZones))
+		zonesInv, err := netutils.GetDNSZonesInfo(ctx, dnsZones)
+		if err != nil && len(zonesInv) == 0 && len(inv) == 0 {
+			logger.Fatalln(err)
+		}
+		fmt.Printf("Recieved %d unique hosts from dns zones\n", len(zonesInv))
+		inv.Merge(zonesInv)
+	}
+
+	if MDNSBrowse {
+		services, err := netutils.BrowseMDNS(ctx, netutils.MDNSServiceTypes, MDNSTimeout)
+		if err != nil {
+			logger.Errorln(err)
+		}
+		fmt.Printf("Found %d mdns services\n", len(services))
+		inv.Merge(netutils.MDNSHosts(services))
+	}
+
+	for _, source := range dhcpLeases {
+		leases, err := netutils.LoadDHCPLeases(ctx, source, DHCPLeasesFormat)
+		if err != nil {
+			logger.Errorln(err)
+			continue
+		}
+		fmt.Printf("Loaded %d leases from %s\n", len(leases), source)
+		inv.Merge(leases)
+	}
 	fmt.Println("Create service params for consul from hosts")
 
-	cp := setConsulCheckParams(dns_zone)
+	cp := setConsulCheckParams(ctx, inv.Hosts())
 	setConsulSVC(ConsulSever, Token, Datacenter, cp)
 
 	stop := time.Now().Unix()